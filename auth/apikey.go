@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewAPIKeyAuthenticator returns Authenticator which resolves static API keys to user IDs
+func NewAPIKeyAuthenticator(keys map[string]int) Authenticator {
+	a := apiKeyAuthenticator{
+		keys: make(map[[sha256.Size]byte]int, len(keys)),
+	}
+	for key, userID := range keys {
+		a.keys[sha256.Sum256([]byte(key))] = userID
+	}
+
+	return a
+}
+
+// apiKeyAuthenticator looks up the keys by their digest so the lookup time
+// does not depend on how much of a guessed key matches a real one
+type apiKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]int
+}
+
+// Authenticate implementation
+func (a apiKeyAuthenticator) Authenticate(credential string) (int, error) {
+	userID, ok := a.keys[sha256.Sum256([]byte(credential))]
+	if !ok {
+		return 0, ErrInvalidCredentials
+	}
+
+	return userID, nil
+}
+
+// ParseAPIKeys parses comma separated key:userID pairs, i.e: "s3cr3t:1,an0th3r:2"
+func ParseAPIKeys(s string) (map[string]int, error) {
+	keys := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		i := strings.LastIndex(pair, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("api key %q is not in key:userID format", pair)
+		}
+
+		userID, err := strconv.Atoi(pair[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("api key %q has invalid user ID: %w", pair[:i], err)
+		}
+		if userID < 1 {
+			return nil, fmt.Errorf("api key %q has invalid user ID %d", pair[:i], userID)
+		}
+		keys[pair[:i]] = userID
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,16 @@
+package auth
+
+import "errors"
+
+var (
+	// ErrInvalidCredentials is returned when the credential is malformed, unknown or wrongly signed
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrExpiredCredentials is returned when the credential is not valid at the current time
+	ErrExpiredCredentials = errors.New("expired credentials")
+)
+
+// Authenticator contract
+type Authenticator interface {
+	// Authenticate resolves the ID of the user owning the credential
+	Authenticate(credential string) (userID int, err error)
+}
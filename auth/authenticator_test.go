@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWTAuthenticator(t *testing.T) {
+	secret := []byte("s3cr3t")
+	now := time.Date(2020, 5, 24, 10, 0, 0, 0, time.UTC)
+	a := jwtAuthenticator{
+		secret: secret,
+		now:    func() time.Time { return now },
+	}
+
+	valid, err := NewJWT(secret, 1337, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := NewJWT(secret, 1337, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := NewJWT([]byte("guess"), 1337, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, _ := encodeSegment(jwtHeader{Alg: "none"})
+	claims, _ := encodeSegment(jwtClaims{Sub: "1337"})
+	unsigned := header + "." + claims + "."
+
+	header, _ = encodeSegment(jwtHeader{Alg: "HS256"})
+	claims, _ = encodeSegment(jwtClaims{Sub: "admin"})
+	nonNumericSubject := header + "." + claims + "." + encodeSignature(secret, header+"."+claims)
+
+	claims, _ = encodeSegment(jwtClaims{Sub: "0"})
+	zeroSubject := header + "." + claims + "." + encodeSignature(secret, header+"."+claims)
+
+	claims, _ = encodeSegment(jwtClaims{Sub: "-1"})
+	negativeSubject := header + "." + claims + "." + encodeSignature(secret, header+"."+claims)
+
+	claims, _ = encodeSegment(jwtClaims{Sub: "1337", Nbf: now.Add(time.Minute).Unix()})
+	notYetValid := header + "." + claims + "." + encodeSignature(secret, header+"."+claims)
+
+	testCases := []struct {
+		name       string
+		token      string
+		wantUserID int
+		wantErr    error
+	}{
+		{name: "valid", token: valid, wantUserID: 1337},
+		{name: "expired", token: expired, wantErr: ErrExpiredCredentials},
+		{name: "not yet valid", token: notYetValid, wantErr: ErrExpiredCredentials},
+		{name: "forged", token: forged, wantErr: ErrInvalidCredentials},
+		{name: "alg none", token: unsigned, wantErr: ErrInvalidCredentials},
+		{name: "non numeric subject", token: nonNumericSubject, wantErr: ErrInvalidCredentials},
+		{name: "zero subject", token: zeroSubject, wantErr: ErrInvalidCredentials},
+		{name: "negative subject", token: negativeSubject, wantErr: ErrInvalidCredentials},
+		{name: "tampered", token: strings.Replace(valid, ".", ".x", 1), wantErr: ErrInvalidCredentials},
+		{name: "malformed", token: "not-a-jwt", wantErr: ErrInvalidCredentials},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			userID, err := a.Authenticate(tc.token)
+			if err != tc.wantErr {
+				t.Fatalf("Authenticate() err = %v, want %v", err, tc.wantErr)
+			}
+			if userID != tc.wantUserID {
+				t.Errorf("Authenticate() userID = %d, want %d", userID, tc.wantUserID)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	keys, err := ParseAPIKeys("s3cr3t:1, with:colon:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAPIKeyAuthenticator(keys)
+	for key, wantUserID := range map[string]int{"s3cr3t": 1, "with:colon": 2} {
+		userID, err := a.Authenticate(key)
+		if err != nil {
+			t.Fatalf("Authenticate(%q) err = %v", key, err)
+		}
+		if userID != wantUserID {
+			t.Errorf("Authenticate(%q) = %d, want %d", key, userID, wantUserID)
+		}
+	}
+
+	if _, err := a.Authenticate("s3cr3"); err != ErrInvalidCredentials {
+		t.Errorf("Authenticate() of unknown key err = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	for _, s := range []string{"s3cr3t", "s3cr3t:0", "s3cr3t:-1"} {
+		if _, err := ParseAPIKeys(s); err == nil {
+			t.Errorf("ParseAPIKeys(%q) succeeded, want an invalid user ID", s)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jwtHeader is the only header accepted and produced, other algorithms
+// (most notably "none") are rejected
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// jwtClaims holds the registered claims in use. The subject is the user ID.
+type jwtClaims struct {
+	Sub string `json:"sub"`
+	Exp int64  `json:"exp,omitempty"`
+	Nbf int64  `json:"nbf,omitempty"`
+	Iat int64  `json:"iat,omitempty"`
+}
+
+// NewJWTAuthenticator returns Authenticator which accepts HS256 signed JSON Web Tokens
+func NewJWTAuthenticator(secret []byte) Authenticator {
+	return jwtAuthenticator{
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+type jwtAuthenticator struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// Authenticate implementation
+func (a jwtAuthenticator) Authenticate(credential string) (int, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalidCredentials
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return 0, ErrInvalidCredentials
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(a.secret, parts[0]+"."+parts[1])) {
+		return 0, ErrInvalidCredentials
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return 0, ErrInvalidCredentials
+	}
+
+	now := a.now().Unix()
+	if claims.Exp != 0 && now >= claims.Exp {
+		return 0, ErrExpiredCredentials
+	}
+	if claims.Nbf != 0 && now < claims.Nbf {
+		return 0, ErrExpiredCredentials
+	}
+
+	// the user IDs start at 1
+	userID, err := strconv.Atoi(claims.Sub)
+	if err != nil || userID < 1 {
+		return 0, ErrInvalidCredentials
+	}
+
+	return userID, nil
+}
+
+// NewJWT signs an HS256 JSON Web Token for the user. A zero expiresAt issues a token which never expires.
+func NewJWT(secret []byte, userID int, expiresAt time.Time) (string, error) {
+	header, err := encodeSegment(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwtClaims{
+		Sub: strconv.Itoa(userID),
+		Iat: time.Now().Unix(),
+	}
+	if !expiresAt.IsZero() {
+		claims.Exp = expiresAt.Unix()
+	}
+
+	payload, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := header + "." + payload
+	return signingInput + "." + encodeSignature(secret, signingInput), nil
+}
+
+func encodeSignature(secret []byte, signingInput string) string {
+	return base64.RawURLEncoding.EncodeToString(sign(secret, signingInput))
+}
+
+func sign(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,56 @@
+package broker
+
+import (
+	"errors"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// ErrClosed is returned when publishing to or subscribing to a closed Broker
+var ErrClosed = errors.New("broker closed")
+
+// EventKind tells which realtime event an Event carries
+type EventKind string
+
+const (
+	// MessageEvent carries a new room message
+	MessageEvent EventKind = "message"
+	// DirectMessageEvent carries a new direct message
+	DirectMessageEvent EventKind = "direct_message"
+	// RetractionEvent carries a retracted message
+	RetractionEvent EventKind = "retraction"
+	// EditEvent carries an edited message
+	EditEvent EventKind = "edit"
+	// UserUpdateEvent carries an updated profile
+	UserUpdateEvent EventKind = "user_update"
+	// TypingEvent carries an ephemeral typing event
+	TypingEvent EventKind = "typing"
+	// ReadReceiptEvent carries an advanced read marker and the author of the read message
+	ReadReceiptEvent EventKind = "read_receipt"
+)
+
+// Event is a realtime event fanned out to every node. Only the fields of its kind are set.
+// Members lists the members of the room of an event about a room other than the
+// global room, as known to the publishing node, so that every node delivers the
+// event to the same users whatever rooms it knows about.
+type Event struct {
+	Kind       EventKind           `json:"kind"`
+	Message    *domain.Message     `json:"message,omitempty"`
+	User       *domain.User        `json:"user,omitempty"`
+	Typing     *domain.TypingEvent `json:"typing,omitempty"`
+	ReadMarker *domain.ReadMarker  `json:"read_marker,omitempty"`
+	AuthorID   int                 `json:"author_id,omitempty"`
+	Members    []int               `json:"members,omitempty"`
+}
+
+// Handler is called with every event published to the broker
+type Handler func(event Event)
+
+// Broker fans the events published by any node out to the subscribers of every node
+type Broker interface {
+	Publish(event Event) error
+	// Subscribe calls the handler with every event published from now on,
+	// including the events published by this node
+	Subscribe(handler Handler) error
+	Close() error
+}
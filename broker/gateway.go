@@ -0,0 +1,33 @@
+package broker
+
+import (
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/wsgateway"
+)
+
+// GatewayHandler returns the Handler delivering the events to the local
+// connections of the gateway. The entries of l are logged as the broker component.
+func GatewayHandler(websocketGateway wsgateway.WebsocketGateway, l logger.Logger) Handler {
+	log := l.Component("broker")
+
+	return func(event Event) {
+		switch {
+		case event.Kind == MessageEvent && event.Message != nil:
+			websocketGateway.EnqueueMessageBroadcast(*event.Message, event.Members)
+		case event.Kind == DirectMessageEvent && event.Message != nil:
+			websocketGateway.EnqueueDirectMessage(*event.Message)
+		case event.Kind == RetractionEvent && event.Message != nil:
+			websocketGateway.EnqueueRetractBroadcast(*event.Message, event.Members)
+		case event.Kind == EditEvent && event.Message != nil:
+			websocketGateway.EnqueueEditBroadcast(*event.Message, event.Members)
+		case event.Kind == UserUpdateEvent && event.User != nil:
+			websocketGateway.EnqueueUserUpdate(*event.User)
+		case event.Kind == TypingEvent && event.Typing != nil:
+			websocketGateway.EnqueueTyping(*event.Typing, event.Members)
+		case event.Kind == ReadReceiptEvent && event.ReadMarker != nil:
+			websocketGateway.EnqueueReadReceipt(*event.ReadMarker, event.AuthorID)
+		default:
+			log.Warnf("Ignoring malformed %q event", event.Kind)
+		}
+	}
+}
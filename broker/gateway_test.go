@@ -0,0 +1,124 @@
+package broker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gifff/chat-server/broker"
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/interactor"
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/metrics"
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/repository"
+	"github.com/gifff/chat-server/websocket"
+	"github.com/gifff/chat-server/wsgateway"
+)
+
+// profiles is a UserDirectory of users without profiles
+type profiles struct{}
+
+func (profiles) Profile(userID int) domain.User {
+	return domain.User{ID: userID}
+}
+
+// recordingConnection is a ConnectionDispatcher which hands the dispatched
+// messages to the test instead of writing them
+type recordingConnection struct {
+	messages chan model.Message
+}
+
+func newRecordingConnection() *recordingConnection {
+	return &recordingConnection{messages: make(chan model.Message, 10)}
+}
+
+func (c *recordingConnection) Dispatch(msg interface{}) {
+	c.messages <- msg.(model.Message)
+}
+
+func (c *recordingConnection) DispatchWait(msg interface{}) bool {
+	c.Dispatch(msg)
+	return true
+}
+
+func (c *recordingConnection) StartDispatcher()              {}
+func (c *recordingConnection) StopDispatcher()               {}
+func (c *recordingConnection) Close(code int, reason string) {}
+
+func (c *recordingConnection) Stats() websocket.DispatchStats {
+	return websocket.DispatchStats{}
+}
+
+func (c *recordingConnection) receive(t *testing.T) model.Message {
+	t.Helper()
+
+	select {
+	case msg := <-c.messages:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return model.Message{}
+	}
+}
+
+// node is a chat server node whose rooms are its own
+type node struct {
+	rooms    interactor.RoomInteractor
+	realtime interactor.RealtimeMessagingInteractor
+	gateway  wsgateway.WebsocketGateway
+}
+
+func newNode(t *testing.T, redisAddr string) node {
+	b, err := broker.NewRedisBroker(broker.RedisOptions{Addr: redisAddr}, logger.NewDiscard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	rooms := interactor.NewRoomInteractor(repository.NewInMemoryRoomRepository())
+	gateway := wsgateway.New(rooms, profiles{}, metrics.NewNoop(), logger.NewDiscard(), wsgateway.Options{})
+	if err := b.Subscribe(broker.GatewayHandler(gateway, logger.NewDiscard())); err != nil {
+		t.Fatal(err)
+	}
+
+	return node{
+		rooms:    rooms,
+		realtime: interactor.NewRealtimeMessagingInteractor(b, rooms, logger.NewDiscard()),
+		gateway:  gateway,
+	}
+}
+
+func TestGatewayHandlerDeliversRoomEventsAcrossNodes(t *testing.T) {
+	server := newFakeRedis(t, "")
+	publisher, receiver := newNode(t, server.addr()), newNode(t, server.addr())
+
+	// only the publishing node knows the room
+	room, err := publisher.rooms.Create("ops", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.rooms.Join(room.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	member, stranger := newRecordingConnection(), newRecordingConnection()
+	receiver.gateway.RegisterConnection(2, wsgateway.Subscription{RoomID: room.ID}, member)
+	receiver.gateway.RegisterConnection(3, wsgateway.Subscription{RoomID: room.ID}, stranger)
+
+	publisher.realtime.DeliverMessage(domain.Message{ID: 10, Type: domain.TextMessage, UserID: 1, RoomID: room.ID, Message: "deploying"})
+	if msg := member.receive(t); msg.Type != model.TextMessage || msg.ID != 10 {
+		t.Errorf("member received %+v, want the room message", msg)
+	}
+
+	publisher.realtime.DeliverTyping(domain.TypingEvent{UserID: 1, RoomID: room.ID})
+	if msg := member.receive(t); msg.Type != model.TypingMessage || msg.User.ID != 1 {
+		t.Errorf("member received %+v, want the typing event", msg)
+	}
+
+	// the direct message follows the room events, so the stranger would have
+	// received them first
+	publisher.realtime.DeliverDirectMessage(domain.Message{ID: 11, Type: domain.TextMessage, UserID: 1, ToUserID: 3, Message: "hi"})
+	if msg := stranger.receive(t); msg.ID != 11 {
+		t.Errorf("stranger received %+v, want only the direct message", msg)
+	}
+}
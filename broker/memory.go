@@ -0,0 +1,57 @@
+package broker
+
+import "sync"
+
+// NewInProcessBroker returns a Broker which calls the handlers of this process
+// synchronously, for a single node deployment
+func NewInProcessBroker() Broker {
+	return &inProcessBroker{}
+}
+
+// inProcessBroker is Broker implementation
+type inProcessBroker struct {
+	mu       sync.RWMutex
+	closed   bool
+	handlers []Handler
+}
+
+// Publish implementation
+func (b *inProcessBroker) Publish(event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+
+	return nil
+}
+
+// Subscribe implementation
+func (b *inProcessBroker) Subscribe(handler Handler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	b.handlers = append(b.handlers, handler)
+
+	return nil
+}
+
+// Close implementation
+func (b *inProcessBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.handlers = nil
+
+	return nil
+}
@@ -0,0 +1,283 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gifff/chat-server/logger"
+)
+
+const (
+	// DefaultRedisChannel is the default RedisOptions.Channel
+	DefaultRedisChannel = "chat-server:events"
+	// DefaultRedisDialTimeout is the default RedisOptions.DialTimeout
+	DefaultRedisDialTimeout = 5 * time.Second
+	// DefaultRedisCommandTimeout is the default RedisOptions.CommandTimeout
+	DefaultRedisCommandTimeout = time.Second
+
+	maxResubscribeBackoff = 5 * time.Second
+)
+
+// RedisOptions configures the Redis broker
+type RedisOptions struct {
+	Addr     string
+	Password string
+	// Channel is the pub/sub channel shared by the nodes. Zero means DefaultRedisChannel.
+	Channel string
+	// DialTimeout zero means DefaultRedisDialTimeout
+	DialTimeout time.Duration
+	// CommandTimeout bounds every command sent to the server, a publish or
+	// subscribe which takes longer fails. Zero means DefaultRedisCommandTimeout.
+	CommandTimeout time.Duration
+}
+
+// NewRedisBroker returns a Broker which publishes the events to a Redis
+// pub/sub channel, so that every node subscribed to it delivers them. The
+// entries of l are logged as the broker component.
+func NewRedisBroker(opts RedisOptions, l logger.Logger) (Broker, error) {
+	if opts.Channel == "" {
+		opts.Channel = DefaultRedisChannel
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = DefaultRedisDialTimeout
+	}
+	if opts.CommandTimeout <= 0 {
+		opts.CommandTimeout = DefaultRedisCommandTimeout
+	}
+
+	b := &redisBroker{opts: opts, log: l.Component("broker")}
+
+	// fail fast when the server cannot be reached
+	pub, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pub.do("PING"); err != nil {
+		pub.Close()
+		return nil, err
+	}
+	b.pub = pub
+
+	return b, nil
+}
+
+// redisBroker is Broker implementation
+type redisBroker struct {
+	opts RedisOptions
+	log  logger.Logger
+
+	mu            sync.Mutex
+	closed        bool
+	subscriptions []*redisSubscription
+	wg            sync.WaitGroup
+
+	// pubMu serializes the commands on pub, it is held during the round trips
+	// rather than mu so that closing and subscribing do not wait on them
+	pubMu sync.Mutex
+	pub   *respConn
+}
+
+// redisSubscription is the connection of a subscriber, it changes when the
+// subscriber reconnects
+type redisSubscription struct {
+	conn *respConn
+}
+
+func (b *redisBroker) dial() (*respConn, error) {
+	return dialRESP(b.opts.Addr, b.opts.Password, b.opts.DialTimeout, b.opts.CommandTimeout)
+}
+
+// Publish implementation
+func (b *redisBroker) Publish(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	// once closed, pub is not dialed again
+	if b.isClosed() {
+		return ErrClosed
+	}
+
+	for attempt := 0; ; attempt++ {
+		if b.pub == nil {
+			if b.pub, err = b.dial(); err != nil {
+				return err
+			}
+		}
+
+		_, err = b.pub.do("PUBLISH", b.opts.Channel, string(payload))
+		if _, isReply := err.(respError); err == nil || isReply {
+			return err
+		}
+
+		// the connection is broken, it is dialed again once
+		b.pub.Close()
+		b.pub = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// Subscribe implementation
+func (b *redisBroker) Subscribe(handler Handler) error {
+	conn, err := b.subscribe()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		conn.Close()
+		return ErrClosed
+	}
+
+	subscription := &redisSubscription{conn: conn}
+	b.subscriptions = append(b.subscriptions, subscription)
+	b.wg.Add(1)
+	go b.receive(subscription, handler)
+
+	return nil
+}
+
+// subscribe returns a connection subscribed to the channel
+func (b *redisBroker) subscribe() (*respConn, error) {
+	conn, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	// the confirmation is bounded like a command, the messages are not
+	if err := conn.conn.SetReadDeadline(time.Now().Add(b.opts.CommandTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.send("SUBSCRIBE", b.opts.Channel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := conn.read()
+	if err == nil {
+		err = conn.conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if values, ok := reply.([]interface{}); !ok || len(values) != 3 || values[0] != "subscribe" {
+		conn.Close()
+		return nil, fmt.Errorf("redis: unexpected subscribe reply %v", reply)
+	}
+
+	return conn, nil
+}
+
+// receive calls the handler with the events of the subscription until the broker
+// is closed. The events published while the subscriber reconnects are lost.
+func (b *redisBroker) receive(subscription *redisSubscription, handler Handler) {
+	defer b.wg.Done()
+
+	conn := subscription.conn
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			conn.Close()
+			if conn = b.resubscribe(subscription, err); conn == nil {
+				return
+			}
+			continue
+		}
+
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 3 || values[0] != "message" {
+			continue
+		}
+		payload, _ := values[2].(string)
+
+		var event Event
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			b.log.Warnf("Ignoring malformed event from redis: %v", err)
+			continue
+		}
+
+		handler(event)
+	}
+}
+
+// resubscribe dials again with a growing backoff until it succeeds, or returns
+// nil once the broker is closed
+func (b *redisBroker) resubscribe(subscription *redisSubscription, cause error) *respConn {
+	backoff := 100 * time.Millisecond
+	for {
+		if b.isClosed() {
+			return nil
+		}
+
+		b.log.Warnf("Redis subscription lost, resubscribing in %s: %v", backoff, cause)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxResubscribeBackoff {
+			backoff = maxResubscribeBackoff
+		}
+
+		conn, err := b.subscribe()
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		subscription.conn = conn
+		b.mu.Unlock()
+
+		return conn
+	}
+}
+
+func (b *redisBroker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+// Close implementation
+func (b *redisBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.closed = true
+	for _, subscription := range b.subscriptions {
+		subscription.conn.Close()
+	}
+	b.mu.Unlock()
+
+	// an ongoing publish completes or times out first
+	b.pubMu.Lock()
+	var err error
+	if b.pub != nil {
+		err = b.pub.Close()
+		b.pub = nil
+	}
+	b.pubMu.Unlock()
+
+	b.wg.Wait()
+
+	return err
+}
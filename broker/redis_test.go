@@ -0,0 +1,348 @@
+package broker_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gifff/chat-server/broker"
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/logger"
+)
+
+// fakeRedis is an in-memory stand-in for the pub/sub commands of a Redis server
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	subscribers map[string]map[net.Conn]*sync.Mutex
+	// stalled leaves the publishes without a reply
+	stalled bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeRedis{
+		ln:          ln,
+		password:    password,
+		conns:       make(map[net.Conn]struct{}),
+		subscribers: make(map[string]map[net.Conn]*sync.Mutex),
+	}
+	go s.serve()
+	t.Cleanup(s.close)
+
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer s.drop(conn)
+
+	var writeMu sync.Mutex
+	write := func(reply string) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		io.WriteString(conn, reply)
+	}
+
+	authenticated := s.password == ""
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case args[0] == "AUTH" && len(args) == 2:
+			if authenticated = args[1] == s.password; !authenticated {
+				write("-WRONGPASS invalid password\r\n")
+				continue
+			}
+			write("+OK\r\n")
+		case !authenticated:
+			write("-NOAUTH Authentication required.\r\n")
+		case args[0] == "PING":
+			write("+PONG\r\n")
+		case args[0] == "SUBSCRIBE" && len(args) == 2:
+			s.mu.Lock()
+			if s.subscribers[args[1]] == nil {
+				s.subscribers[args[1]] = make(map[net.Conn]*sync.Mutex)
+			}
+			s.subscribers[args[1]][conn] = &writeMu
+			s.mu.Unlock()
+			write("*3\r\n$9\r\nsubscribe\r\n" + bulk(args[1]) + ":1\r\n")
+		case args[0] == "PUBLISH" && len(args) == 3 && s.isStalled():
+		case args[0] == "PUBLISH" && len(args) == 3:
+			write(":" + strconv.Itoa(s.publish(args[1], args[2])) + "\r\n")
+		default:
+			write("-ERR unknown command\r\n")
+		}
+	}
+}
+
+func (s *fakeRedis) publish(channel, payload string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, writeMu := range s.subscribers[channel] {
+		writeMu.Lock()
+		io.WriteString(conn, "*3\r\n$7\r\nmessage\r\n"+bulk(channel)+bulk(payload))
+		writeMu.Unlock()
+	}
+
+	return len(s.subscribers[channel])
+}
+
+func (s *fakeRedis) stall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stalled = true
+}
+
+func (s *fakeRedis) isStalled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stalled
+}
+
+func (s *fakeRedis) subscriberCount(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.subscribers[channel])
+}
+
+// kickSubscribers closes the connections of the subscribers of the channel
+func (s *fakeRedis) kickSubscribers(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.subscribers[channel] {
+		conn.Close()
+	}
+	delete(s.subscribers, channel)
+}
+
+func (s *fakeRedis) drop(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn.Close()
+	delete(s.conns, conn)
+	for _, subscribers := range s.subscribers {
+		delete(subscribers, conn)
+	}
+}
+
+func (s *fakeRedis) close() {
+	s.ln.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// readCommand reads an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
+
+// subscribe returns the channel of the events received by the broker
+func subscribe(t *testing.T, b broker.Broker) <-chan broker.Event {
+	events := make(chan broker.Event, 10)
+	if err := b.Subscribe(func(event broker.Event) {
+		events <- event
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func receive(t *testing.T, events <-chan broker.Event) broker.Event {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return broker.Event{}
+	}
+}
+
+func TestRedisBrokerFansOutToEveryNode(t *testing.T) {
+	server := newFakeRedis(t, "s3cr3t")
+
+	if _, err := broker.NewRedisBroker(broker.RedisOptions{Addr: server.addr(), Password: "wrong"}, logger.NewDiscard()); err == nil {
+		t.Fatal("connected with a wrong password")
+	}
+
+	var nodes []broker.Broker
+	var events []<-chan broker.Event
+	for i := 0; i < 2; i++ {
+		b, err := broker.NewRedisBroker(broker.RedisOptions{Addr: server.addr(), Password: "s3cr3t"}, logger.NewDiscard())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		nodes = append(nodes, b)
+		events = append(events, subscribe(t, b))
+	}
+
+	published := []broker.Event{
+		{Kind: broker.MessageEvent, Message: &domain.Message{ID: 1, UserID: 100, Message: "hello", RoomID: 2}},
+		{Kind: broker.ReadReceiptEvent, ReadMarker: &domain.ReadMarker{UserID: 200, MessageID: 1}, AuthorID: 100},
+	}
+	for i, event := range published {
+		// every event is published once, by a single node
+		if err := nodes[i].Publish(event); err != nil {
+			t.Fatal(err)
+		}
+
+		for node, received := range events {
+			if got := receive(t, received); !reflect.DeepEqual(got, event) {
+				t.Errorf("node %d received %+v, want %+v", node, got, event)
+			}
+		}
+	}
+
+	for node, received := range events {
+		if len(received) != 0 {
+			t.Errorf("node %d received %d more events", node, len(received))
+		}
+	}
+}
+
+func TestRedisBrokerResubscribes(t *testing.T) {
+	server := newFakeRedis(t, "")
+
+	b, err := broker.NewRedisBroker(broker.RedisOptions{Addr: server.addr()}, logger.NewDiscard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := subscribe(t, b)
+
+	server.kickSubscribers(broker.DefaultRedisChannel)
+	deadline := time.Now().Add(2 * time.Second)
+	for server.subscriberCount(broker.DefaultRedisChannel) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the broker to resubscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := b.Publish(broker.Event{Kind: broker.UserUpdateEvent, User: &domain.User{ID: 100, Name: "back"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, events); got.User == nil || got.User.Name != "back" {
+		t.Errorf("received %+v, want the user update", got)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(broker.Event{Kind: broker.UserUpdateEvent}); err != broker.ErrClosed {
+		t.Errorf("Publish after Close = %v, want %v", err, broker.ErrClosed)
+	}
+}
+
+func TestRedisBrokerPublishTimesOut(t *testing.T) {
+	const commandTimeout = 300 * time.Millisecond
+
+	server := newFakeRedis(t, "")
+	b, err := broker.NewRedisBroker(broker.RedisOptions{Addr: server.addr(), CommandTimeout: commandTimeout}, logger.NewDiscard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	server.stall()
+	published := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		published <- b.Publish(broker.Event{Kind: broker.UserUpdateEvent, User: &domain.User{ID: 100}})
+	}()
+
+	// the stalled publish does not hold the subscribers back
+	time.Sleep(commandTimeout / 3)
+	subscribe(t, b)
+	select {
+	case err := <-published:
+		t.Fatalf("Publish returned %v before subscribing completed, want it still waiting", err)
+	default:
+	}
+
+	select {
+	case err := <-published:
+		if err == nil {
+			t.Error("Publish to a stalled server succeeded")
+		}
+		// the publish is attempted again on a new connection
+		if elapsed := time.Since(start); elapsed > 3*commandTimeout {
+			t.Errorf("Publish returned after %s, want at most %s", elapsed, 3*commandTimeout)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Publish to a stalled server never returned")
+	}
+}
@@ -0,0 +1,152 @@
+package broker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// respError is an error reply of the server
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+// respConn speaks the subset of RESP, the Redis serialization protocol, needed
+// by the broker. Every command must complete within the command timeout, only
+// read waits for the next reply for as long as it takes.
+type respConn struct {
+	conn           net.Conn
+	r              *bufio.Reader
+	w              *bufio.Writer
+	commandTimeout time.Duration
+}
+
+// dialRESP connects to the server and authenticates when a password is given
+func dialRESP(addr string, password string, dialTimeout time.Duration, commandTimeout time.Duration) (*respConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &respConn{
+		conn:           conn,
+		r:              bufio.NewReader(conn),
+		w:              bufio.NewWriter(conn),
+		commandTimeout: commandTimeout,
+	}
+
+	if password != "" {
+		if _, err := c.do("AUTH", password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// do sends the command and returns its reply, error replies are returned as errors
+func (c *respConn) do(args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.commandTimeout)); err != nil {
+		return nil, err
+	}
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+
+	reply, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := reply.(respError); ok {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// send writes the command as an array of bulk strings
+func (c *respConn) send(args ...string) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.commandTimeout)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	return c.w.Flush()
+}
+
+// read returns the next reply: a string for simple and bulk strings, an int64
+// for integers, a respError for errors, a []interface{} for arrays and nil for
+// the null bulk string and array
+func (c *respConn) read() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("resp: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("resp: unexpected reply %q", line)
+	}
+}
+
+func (c *respConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("resp: malformed line %q", line)
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func (c *respConn) Close() error {
+	return c.conn.Close()
+}
@@ -1,29 +1,260 @@
 package chatservice
 
 import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
 	"github.com/gifff/chat-server/interactor"
+	"github.com/gifff/chat-server/repository"
+)
+
+// TypingTimeout is how long a typing event lasts unless the client sends another one
+const TypingTimeout = 5 * time.Second
+
+var (
+	// ErrEmptyMessage is returned when the message body is blank
+	ErrEmptyMessage = errors.New("message must not be empty")
+	// ErrMessageNotFound is returned when the referenced message does not exist
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrNotMessageAuthor is returned when a user acts on a message written by someone else
+	ErrNotMessageAuthor = errors.New("message is written by another user")
+	// ErrMessageRetracted is returned when acting on a message which has been retracted
+	ErrMessageRetracted = errors.New("message has been retracted")
+	// ErrRoomNotFound is returned when the referenced room does not exist
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrNotRoomMember is returned when a user acts on a room without being a member of it
+	ErrNotRoomMember = errors.New("user is not a member of the room")
+	// ErrInvalidRecipient is returned when a direct message is addressed to nobody or to the sender
+	ErrInvalidRecipient = errors.New("direct message recipient must be another user")
+	// ErrNotParticipant is returned when a user reads direct messages of a conversation they are not part of
+	ErrNotParticipant = errors.New("user is not a participant of the conversation")
 )
 
 // ChatService contract
 type ChatService interface {
-	SendMessage(message string, fromUserID int)
+	SendMessage(message string, fromUserID int, roomID int) (domain.Message, error)
+	SendDirectMessage(message string, fromUserID int, toUserID int) (domain.Message, error)
+	RetractMessage(messageID int64, userID int) error
+	EditMessage(messageID int64, message string, userID int) (domain.Message, error)
+	MessageRevisions(messageID int64, userID int) ([]domain.MessageRevision, error)
+	ListMessages(query repository.MessageQuery, userID int) (messages []domain.Message, hasMore bool, err error)
+	// SendTyping relays that the user is typing in the room, or to toUserID when set, without storing anything
+	SendTyping(fromUserID int, roomID int, toUserID int) error
+	// MarkRead records that the user has read up to the message in the room, or in the
+	// direct messages with peerID when set, and sends a read receipt when it moved forward
+	MarkRead(userID int, roomID int, peerID int, messageID int64) error
+	// UnreadCounts returns the unread counts of the rooms of the user followed by their direct conversations
+	UnreadCounts(userID int) ([]domain.UnreadCount, error)
 }
 
 // NewService returns chatService instance which satisfies ChatService interface
-func NewService(messageInteractor interactor.MessageInteractor, realtimeMessagingInteractor interactor.RealtimeMessagingInteractor) ChatService {
+func NewService(messageInteractor interactor.MessageInteractor, roomInteractor interactor.RoomInteractor, readMarkerInteractor interactor.ReadMarkerInteractor, realtimeMessagingInteractor interactor.RealtimeMessagingInteractor) ChatService {
 	return chatService{
 		messageInteractor:           messageInteractor,
+		roomInteractor:              roomInteractor,
+		readMarkerInteractor:        readMarkerInteractor,
 		realtimeMessagingInteractor: realtimeMessagingInteractor,
 	}
 }
 
 type chatService struct {
 	messageInteractor           interactor.MessageInteractor
+	roomInteractor              interactor.RoomInteractor
+	readMarkerInteractor        interactor.ReadMarkerInteractor
 	realtimeMessagingInteractor interactor.RealtimeMessagingInteractor
 }
 
 // SendMessage implementation
-func (c chatService) SendMessage(message string, fromUserID int) {
-	msg := c.messageInteractor.Create(message, fromUserID)
+func (c chatService) SendMessage(message string, fromUserID int, roomID int) (domain.Message, error) {
+	if strings.TrimSpace(message) == "" {
+		return domain.Message{}, ErrEmptyMessage
+	}
+
+	if err := checkRoomMember(c.roomInteractor, roomID, fromUserID); err != nil {
+		return domain.Message{}, err
+	}
+
+	msg, err := c.messageInteractor.Create(domain.Message{
+		Message: message,
+		UserID:  fromUserID,
+		RoomID:  roomID,
+	})
+	if err != nil {
+		return domain.Message{}, err
+	}
+
 	c.realtimeMessagingInteractor.DeliverMessage(msg)
+
+	return msg, nil
+}
+
+// SendDirectMessage implementation
+func (c chatService) SendDirectMessage(message string, fromUserID int, toUserID int) (domain.Message, error) {
+	if strings.TrimSpace(message) == "" {
+		return domain.Message{}, ErrEmptyMessage
+	}
+
+	if toUserID < 1 || toUserID == fromUserID {
+		return domain.Message{}, ErrInvalidRecipient
+	}
+
+	msg, err := c.messageInteractor.Create(domain.Message{
+		Message:  message,
+		UserID:   fromUserID,
+		ToUserID: toUserID,
+	})
+	if err != nil {
+		return domain.Message{}, err
+	}
+
+	c.realtimeMessagingInteractor.DeliverDirectMessage(msg)
+
+	return msg, nil
+}
+
+// RetractMessage implementation
+func (c chatService) RetractMessage(messageID int64, userID int) error {
+	msg, err := c.messageInteractor.Get(messageID)
+	if err != nil {
+		return mapRepositoryError(err)
+	}
+
+	if msg.UserID != userID {
+		return ErrNotMessageAuthor
+	}
+
+	msg, err = c.messageInteractor.Retract(messageID)
+	if err != nil {
+		return mapRepositoryError(err)
+	}
+
+	c.realtimeMessagingInteractor.DeliverRetraction(msg)
+
+	return nil
+}
+
+// EditMessage implementation
+func (c chatService) EditMessage(messageID int64, message string, userID int) (domain.Message, error) {
+	if strings.TrimSpace(message) == "" {
+		return domain.Message{}, ErrEmptyMessage
+	}
+
+	msg, err := c.messageInteractor.Get(messageID)
+	if err != nil {
+		return domain.Message{}, mapRepositoryError(err)
+	}
+
+	if msg.UserID != userID {
+		return domain.Message{}, ErrNotMessageAuthor
+	}
+
+	msg, err = c.messageInteractor.Edit(messageID, message)
+	if err != nil {
+		return domain.Message{}, mapRepositoryError(err)
+	}
+
+	c.realtimeMessagingInteractor.DeliverEdit(msg)
+
+	return msg, nil
+}
+
+// MessageRevisions implementation
+func (c chatService) MessageRevisions(messageID int64, userID int) ([]domain.MessageRevision, error) {
+	msg, err := c.messageInteractor.Get(messageID)
+	if err != nil {
+		return nil, mapRepositoryError(err)
+	}
+
+	if err := c.checkReader(msg, userID); err != nil {
+		return nil, err
+	}
+
+	if msg.IsRetracted() {
+		return nil, ErrMessageRetracted
+	}
+
+	revisions, err := c.messageInteractor.Revisions(messageID)
+	if err != nil {
+		return nil, mapRepositoryError(err)
+	}
+
+	return revisions, nil
+}
+
+// ListMessages implementation
+func (c chatService) ListMessages(query repository.MessageQuery, userID int) ([]domain.Message, bool, error) {
+	if query.IsDirect() {
+		if query.Between[0] != userID && query.Between[1] != userID {
+			return nil, false, ErrNotParticipant
+		}
+	} else if err := checkRoomMember(c.roomInteractor, query.RoomID, userID); err != nil {
+		return nil, false, err
+	}
+
+	if query.WithDirectOf != 0 && query.WithDirectOf != userID {
+		return nil, false, ErrNotParticipant
+	}
+
+	return c.messageInteractor.List(query)
+}
+
+// SendTyping implementation
+func (c chatService) SendTyping(fromUserID int, roomID int, toUserID int) error {
+	if toUserID != 0 {
+		if toUserID < 1 || toUserID == fromUserID {
+			return ErrInvalidRecipient
+		}
+	} else if err := checkRoomMember(c.roomInteractor, roomID, fromUserID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	event := domain.TypingEvent{
+		UserID:    fromUserID,
+		RoomID:    roomID,
+		ToUserID:  toUserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(TypingTimeout),
+	}
+	if event.IsDirect() {
+		event.RoomID = domain.GlobalRoomID
+	}
+
+	c.realtimeMessagingInteractor.DeliverTyping(event)
+
+	return nil
+}
+
+// checkReader tells whether the user may read the message: direct messages are
+// readable by their participants and room messages by the room members
+func (c chatService) checkReader(msg domain.Message, userID int) error {
+	if msg.IsDirect() {
+		if !msg.IsParticipant(userID) {
+			return ErrNotParticipant
+		}
+		return nil
+	}
+
+	if !c.roomInteractor.IsMember(msg.RoomID, userID) {
+		return ErrNotRoomMember
+	}
+
+	return nil
+}
+
+func mapRepositoryError(err error) error {
+	switch err {
+	case repository.ErrMessageNotFound:
+		return ErrMessageNotFound
+	case repository.ErrMessageAlreadyRetracted:
+		return ErrMessageRetracted
+	case repository.ErrRoomNotFound:
+		return ErrRoomNotFound
+	case repository.ErrUserNotFound:
+		return ErrUserNotFound
+	default:
+		return err
+	}
 }
@@ -0,0 +1,105 @@
+package chatservice
+
+import (
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+// MarkRead implementation
+func (c chatService) MarkRead(userID int, roomID int, peerID int, messageID int64) error {
+	if peerID != 0 {
+		if peerID < 1 || peerID == userID {
+			return ErrInvalidRecipient
+		}
+		roomID = domain.GlobalRoomID
+	} else if err := checkRoomMember(c.roomInteractor, roomID, userID); err != nil {
+		return err
+	}
+
+	msg, err := c.messageInteractor.Get(messageID)
+	if err != nil {
+		return mapRepositoryError(err)
+	}
+
+	// the message must belong to the conversation being marked
+	if peerID != 0 {
+		if !msg.IsParticipant(userID) || !msg.IsParticipant(peerID) {
+			return ErrMessageNotFound
+		}
+	} else if msg.IsDirect() || msg.RoomID != roomID {
+		return ErrMessageNotFound
+	}
+
+	marker, advanced, err := c.readMarkerInteractor.MarkRead(domain.ReadMarker{
+		UserID:    userID,
+		RoomID:    roomID,
+		PeerID:    peerID,
+		MessageID: messageID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if advanced {
+		c.realtimeMessagingInteractor.DeliverReadReceipt(marker, msg.UserID)
+	}
+
+	return nil
+}
+
+// UnreadCounts implementation
+func (c chatService) UnreadCounts(userID int) ([]domain.UnreadCount, error) {
+	markers, err := c.readMarkerInteractor.List(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type conversationKey struct {
+		roomID int
+		peerID int
+	}
+	lastReadIDs := make(map[conversationKey]int64, len(markers))
+	for _, marker := range markers {
+		lastReadIDs[conversationKey{marker.RoomID, marker.PeerID}] = marker.MessageID
+	}
+
+	rooms, err := c.roomInteractor.List()
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []domain.UnreadCount{{RoomID: domain.GlobalRoomID}}
+	for _, room := range rooms {
+		if c.roomInteractor.IsMember(room.ID, userID) {
+			conversations = append(conversations, domain.UnreadCount{RoomID: room.ID})
+		}
+	}
+
+	peers, err := c.messageInteractor.Peers(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, peerID := range peers {
+		conversations = append(conversations, domain.UnreadCount{PeerID: peerID})
+	}
+
+	for i, conversation := range conversations {
+		query := repository.MessageQuery{
+			RoomID:  conversation.RoomID,
+			AfterID: lastReadIDs[conversationKey{conversation.RoomID, conversation.PeerID}],
+		}
+		if conversation.PeerID != 0 {
+			query.Between = [2]int{userID, conversation.PeerID}
+		}
+
+		unread, err := c.messageInteractor.CountAfter(query, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations[i].LastReadID = query.AfterID
+		conversations[i].Unread = unread
+	}
+
+	return conversations, nil
+}
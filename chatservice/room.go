@@ -0,0 +1,86 @@
+package chatservice
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/interactor"
+)
+
+// ErrEmptyRoomName is returned when the room name is blank
+var ErrEmptyRoomName = errors.New("room name must not be empty")
+
+// RoomService contract
+type RoomService interface {
+	CreateRoom(name string, userID int) (domain.Room, error)
+	GetRoom(roomID int) (domain.Room, error)
+	ListRooms() ([]domain.Room, error)
+	JoinRoom(roomID int, userID int) error
+	LeaveRoom(roomID int, userID int) error
+	// CheckMember returns ErrRoomNotFound or ErrNotRoomMember unless the user is a member of the room
+	CheckMember(roomID int, userID int) error
+}
+
+// NewRoomService returns roomService instance which satisfies RoomService interface
+func NewRoomService(roomInteractor interactor.RoomInteractor) RoomService {
+	return roomService{
+		roomInteractor: roomInteractor,
+	}
+}
+
+type roomService struct {
+	roomInteractor interactor.RoomInteractor
+}
+
+// CreateRoom implementation
+func (r roomService) CreateRoom(name string, userID int) (domain.Room, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return domain.Room{}, ErrEmptyRoomName
+	}
+
+	return r.roomInteractor.Create(name, userID)
+}
+
+// GetRoom implementation
+func (r roomService) GetRoom(roomID int) (domain.Room, error) {
+	room, err := r.roomInteractor.Get(roomID)
+	if err != nil {
+		return domain.Room{}, mapRepositoryError(err)
+	}
+
+	return room, nil
+}
+
+// ListRooms implementation
+func (r roomService) ListRooms() ([]domain.Room, error) {
+	return r.roomInteractor.List()
+}
+
+// JoinRoom implementation
+func (r roomService) JoinRoom(roomID int, userID int) error {
+	return mapRepositoryError(r.roomInteractor.Join(roomID, userID))
+}
+
+// LeaveRoom implementation
+func (r roomService) LeaveRoom(roomID int, userID int) error {
+	return mapRepositoryError(r.roomInteractor.Leave(roomID, userID))
+}
+
+// CheckMember implementation
+func (r roomService) CheckMember(roomID int, userID int) error {
+	return checkRoomMember(r.roomInteractor, roomID, userID)
+}
+
+func checkRoomMember(roomInteractor interactor.RoomInteractor, roomID int, userID int) error {
+	if roomInteractor.IsMember(roomID, userID) {
+		return nil
+	}
+
+	if _, err := roomInteractor.Get(roomID); err != nil {
+		return mapRepositoryError(err)
+	}
+
+	return ErrNotRoomMember
+}
@@ -0,0 +1,99 @@
+package chatservice
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/interactor"
+)
+
+// maxUserNameLength is the maximum number of characters of a display name
+const maxUserNameLength = 64
+
+var (
+	// ErrUserNotFound is returned when the user has no profile
+	ErrUserNotFound = errors.New("user not found")
+	// ErrNotProfileOwner is returned when a user updates the profile of someone else
+	ErrNotProfileOwner = errors.New("profile belongs to another user")
+	// ErrInvalidUserName is returned when the display name is blank or too long
+	ErrInvalidUserName = errors.New("name must be between 1 and 64 characters")
+	// ErrInvalidAvatarURL is returned when the avatar URL is not an absolute http(s) URL
+	ErrInvalidAvatarURL = errors.New("avatar URL must be an absolute http or https URL")
+)
+
+// UserService contract
+type UserService interface {
+	GetUser(userID int) (domain.User, error)
+	// UpdateUser replaces the profile of the user and notifies the connected clients when it changed
+	UpdateUser(userID int, name string, avatarURL string, callerID int) (domain.User, error)
+	// Profile returns the profile of the user, holding only the ID when there is none
+	Profile(userID int) domain.User
+}
+
+// NewUserService returns userService instance which satisfies UserService interface
+func NewUserService(userInteractor interactor.UserInteractor, realtimeMessagingInteractor interactor.RealtimeMessagingInteractor) UserService {
+	return userService{
+		userInteractor:              userInteractor,
+		realtimeMessagingInteractor: realtimeMessagingInteractor,
+	}
+}
+
+type userService struct {
+	userInteractor              interactor.UserInteractor
+	realtimeMessagingInteractor interactor.RealtimeMessagingInteractor
+}
+
+// GetUser implementation
+func (u userService) GetUser(userID int) (domain.User, error) {
+	user, err := u.userInteractor.Get(userID)
+	if err != nil {
+		return domain.User{}, mapRepositoryError(err)
+	}
+
+	return user, nil
+}
+
+// UpdateUser implementation
+func (u userService) UpdateUser(userID int, name string, avatarURL string, callerID int) (domain.User, error) {
+	if userID != callerID {
+		return domain.User{}, ErrNotProfileOwner
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxUserNameLength {
+		return domain.User{}, ErrInvalidUserName
+	}
+
+	if avatarURL != "" {
+		parsed, err := url.Parse(avatarURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return domain.User{}, ErrInvalidAvatarURL
+		}
+	}
+
+	current := u.userInteractor.Profile(userID)
+	if current.Name == name && current.AvatarURL == avatarURL && !current.UpdatedAt.IsZero() {
+		return current, nil
+	}
+
+	user, err := u.userInteractor.Update(domain.User{
+		ID:        userID,
+		Name:      name,
+		AvatarURL: avatarURL,
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	u.realtimeMessagingInteractor.DeliverUserUpdate(user)
+
+	return user, nil
+}
+
+// Profile implementation
+func (u userService) Profile(userID int) domain.User {
+	return u.userInteractor.Profile(userID)
+}
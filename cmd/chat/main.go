@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gifff/chat-server/logger"
+)
+
+var (
+	logLevel  string
+	serverURL string
+	token     string
+	roomID    int
+)
+
+func main() {
+	flag.StringVar(&logLevel, "log-level", "WARN", "log level. Available options: DEBUG, INFO, WARN, DEBUG")
+	flag.StringVar(&serverURL, "server-url", "http://localhost:8080", "chat server URL")
+	flag.StringVar(&token, "token", os.Getenv("CHAT_TOKEN"), "JWT or API key to be embed in Authorization header. Defaults to $CHAT_TOKEN")
+	flag.IntVar(&roomID, "room", 0, "room to join on start, 0 is the global room")
+	flag.Parse()
+
+	log.SetOutput(logger.NewLevelFilter(logLevel, os.Stderr))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := newSession(ctx, serverURL, token, newPrinter(os.Stdout))
+	if err != nil {
+		log.Fatalf("[ERROR] %s", err)
+	}
+	if err := s.join(roomID); err != nil {
+		log.Fatalf("[ERROR] unable to join room %d: %s", roomID, err)
+	}
+	defer s.close()
+
+	s.out.notice("type a message and press enter to send it, /help lists the commands")
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-quit:
+			return
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+
+			done, err := s.handle(line)
+			if err != nil {
+				s.out.notice(fmt.Sprintf("error: %s", err))
+			}
+			if done {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// printer writes the incoming messages and the notices of the client, one line
+// at a time, from any goroutine
+type printer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func newPrinter(out io.Writer) *printer {
+	return &printer{out: out}
+}
+
+func (p *printer) println(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintln(p.out, line)
+}
+
+// notice prints a line of the client itself
+func (p *printer) notice(text string) {
+	p.println("* " + text)
+}
+
+// message prints the message, leaving out the events the chat does not show
+func (p *printer) message(msg model.Message) {
+	author := displayName(msg.User)
+	if msg.ToUserID != 0 && msg.Type != model.TypingMessage {
+		author = fmt.Sprintf("%s → user %d", author, msg.ToUserID)
+	}
+
+	switch msg.Type {
+	case model.TextMessage:
+		body := msg.Message
+		if msg.Retracted {
+			body = "(retracted)"
+		} else if msg.Revision > 0 {
+			body += " (edited)"
+		}
+		p.println(fmt.Sprintf("[%s] #%d <%s> %s", clock(msg.Timestamp), msg.ID, author, body))
+	case model.EditMessage:
+		p.println(fmt.Sprintf("[%s] #%d <%s> %s (edited)", clock(msg.Timestamp), msg.ID, author, msg.Message))
+	case model.RetractMessage:
+		p.println(fmt.Sprintf("[%s] #%d <%s> (retracted)", clock(msg.Timestamp), msg.ID, author))
+	case model.TypingMessage:
+		p.notice(fmt.Sprintf("%s is typing", author))
+	case model.UserUpdatedMessage:
+		p.notice(fmt.Sprintf("user %d is now known as %s", msg.User.ID, author))
+	}
+}
+
+func displayName(user model.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+
+	return fmt.Sprintf("user %d", user.ID)
+}
+
+func clock(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return t.Local().Format("15:04:05")
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/wsclient"
+)
+
+const historyLimit = 20
+
+// errNotListening is returned when sending after the last /join failed
+var errNotListening = errors.New("not listening to any room, /join one")
+
+const helpText = `commands:
+  /join <room>         listen to a room, 0 is the global room
+  /dm <user>           send the next lines to the user only, /dm alone goes back to the room
+  /history [limit]     show the latest messages of the room or of the direct conversation
+  /edit <id> <text>    replace the body of one of your messages
+  /retract <id>        retract one of your messages
+  /help                show this help
+  /quit                leave`
+
+// session is the state of the chat: the room listened to, the user the lines
+// are sent to in direct mode and the client of the listened room
+type session struct {
+	ctx     context.Context
+	baseURL *url.URL
+	header  http.Header
+	http    *http.Client
+	out     *printer
+
+	client   *wsclient.Client
+	roomID   int
+	dmUserID int
+	// stopErrors ends the goroutine reporting the errors of client
+	stopErrors chan struct{}
+}
+
+func newSession(ctx context.Context, serverURL string, token string, out *printer) (*session, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(serverURL, "/"))
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") {
+		return nil, fmt.Errorf("invalid server URL %q", serverURL)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+
+	return &session{
+		ctx:     ctx,
+		baseURL: baseURL,
+		header:  header,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		out:     out,
+	}, nil
+}
+
+// handle runs the command or sends the line and tells whether the user wants to leave
+func (s *session) handle(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false, nil
+	}
+
+	if !strings.HasPrefix(line, "/") {
+		return false, s.send(line)
+	}
+
+	fields := strings.Fields(line)
+	switch command, args := fields[0], fields[1:]; command {
+	case "/quit":
+		return true, nil
+	case "/help":
+		s.out.notice(helpText)
+		return false, nil
+	case "/join":
+		if len(args) != 1 {
+			return false, errors.New("usage: /join <room>")
+		}
+		room, err := strconv.Atoi(args[0])
+		if err != nil || room < 0 {
+			return false, errors.New("room must be a room ID")
+		}
+		return false, s.join(room)
+	case "/dm":
+		return false, s.directMode(args)
+	case "/history":
+		limit := historyLimit
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return false, errors.New("limit must be a positive number")
+			}
+			limit = n
+		}
+		return false, s.history(limit)
+	case "/edit":
+		if len(args) < 2 {
+			return false, errors.New("usage: /edit <id> <text>")
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return false, errors.New("id must be a message ID")
+		}
+		if s.client == nil {
+			return false, errNotListening
+		}
+		return false, s.client.Edit(id, strings.Join(args[1:], " "))
+	case "/retract":
+		if len(args) != 1 {
+			return false, errors.New("usage: /retract <id>")
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return false, errors.New("id must be a message ID")
+		}
+		if s.client == nil {
+			return false, errNotListening
+		}
+		return false, s.client.Retract(id)
+	default:
+		return false, fmt.Errorf("unknown command %s, /help lists the commands", command)
+	}
+}
+
+func (s *session) send(text string) error {
+	if s.client == nil {
+		return errNotListening
+	}
+	if s.dmUserID != 0 {
+		return s.client.SendDirectMessage(s.dmUserID, text)
+	}
+
+	return s.client.SendText(text)
+}
+
+// join becomes a member of the room and listens to it instead of the current one
+func (s *session) join(roomID int) error {
+	if roomID != 0 {
+		if err := s.request(http.MethodPost, fmt.Sprintf("/rooms/%d/members", roomID), nil, nil); err != nil {
+			return err
+		}
+	}
+
+	client := wsclient.NewClientOptions(s.ctx, s.listenURI(roomID), s.header, wsclient.Options{
+		Reconnect: &wsclient.ReconnectPolicy{Jitter: 0.2},
+	})
+	client.AttachMessageObserver(s.out.message)
+	client.AttachStateObserver(func(state wsclient.State, err error) {
+		switch {
+		case state == wsclient.Disconnected && err != nil:
+			s.out.notice(fmt.Sprintf("disconnected: %s", err))
+		case state != wsclient.Connecting:
+			s.out.notice(state.String())
+		}
+	})
+
+	// the current room is left first, so that no message of both is printed twice
+	s.leave()
+
+	errs, err := client.Listen()
+	if err != nil {
+		return err
+	}
+	stopErrors := make(chan struct{})
+	go s.reportErrors(errs, stopErrors)
+
+	s.client = client
+	s.stopErrors = stopErrors
+	s.roomID = roomID
+	s.dmUserID = 0
+
+	s.out.notice(fmt.Sprintf("listening to %s", roomName(roomID)))
+
+	return nil
+}
+
+func (s *session) directMode(args []string) error {
+	switch len(args) {
+	case 0:
+		s.dmUserID = 0
+		s.out.notice(fmt.Sprintf("sending to %s", roomName(s.roomID)))
+		return nil
+	case 1:
+		userID, err := strconv.Atoi(args[0])
+		if err != nil || userID < 1 {
+			return errors.New("user must be a user ID")
+		}
+
+		s.dmUserID = userID
+		s.out.notice(fmt.Sprintf("sending to user %d only, /dm alone goes back to %s", userID, roomName(s.roomID)))
+		return nil
+	default:
+		return errors.New("usage: /dm <user>")
+	}
+}
+
+// history prints the latest messages of the current conversation
+func (s *session) history(limit int) error {
+	path := "/messages"
+	switch {
+	case s.dmUserID != 0:
+		path = fmt.Sprintf("/dms/%d/messages", s.dmUserID)
+	case s.roomID != 0:
+		path = fmt.Sprintf("/rooms/%d/messages", s.roomID)
+	}
+
+	var page model.MessagePage
+	if err := s.request(http.MethodGet, path+"?limit="+strconv.Itoa(limit), nil, &page); err != nil {
+		return err
+	}
+
+	if len(page.Messages) == 0 {
+		s.out.notice("no messages yet")
+		return nil
+	}
+	for _, msg := range page.Messages {
+		s.out.message(msg)
+	}
+
+	return nil
+}
+
+func (s *session) listenURI(roomID int) string {
+	u := *s.baseURL
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path += "/messages/listen"
+	if roomID != 0 {
+		u.Path = fmt.Sprintf("%s/rooms/%d/messages/listen", s.baseURL.Path, roomID)
+	}
+
+	return u.String()
+}
+
+// request calls the HTTP API and decodes the response into out unless it is nil
+func (s *session) request(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, method, s.baseURL.String()+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header = s.header.Clone()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr model.Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return errors.New(apiErr.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// reportErrors prints the error ending the listener until stop is closed
+func (s *session) reportErrors(errs <-chan error, stop <-chan struct{}) {
+	select {
+	case err, ok := <-errs:
+		if ok {
+			s.out.notice(fmt.Sprintf("connection lost: %s", err))
+		}
+	case <-stop:
+	}
+}
+
+// leave stops listening to the current room
+func (s *session) leave() {
+	if s.client == nil {
+		return
+	}
+
+	_ = s.client.Stop(time.Second)
+	close(s.stopErrors)
+	s.client = nil
+	s.stopErrors = nil
+}
+
+func (s *session) close() {
+	s.leave()
+}
+
+func roomName(roomID int) string {
+	if roomID == 0 {
+		return "the global room"
+	}
+
+	return fmt.Sprintf("room %d", roomID)
+}
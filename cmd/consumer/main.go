@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -19,14 +18,14 @@ import (
 var (
 	logLevel      string
 	serverURI     string
-	userID        int
+	token         string
 	numOfConsumer int
 )
 
 func main() {
 	flag.StringVar(&logLevel, "log-level", "INFO", "log level. Available options: DEBUG, INFO, WARN, DEBUG")
 	flag.StringVar(&serverURI, "server-uri", "", "websocket server URI. i.e: ws://localhost:8080/messages/listen")
-	flag.IntVar(&userID, "user-id", 1, "user id to be embed in X-User-Id header")
+	flag.StringVar(&token, "token", os.Getenv("CHAT_TOKEN"), "JWT or API key to be embed in Authorization header. Defaults to $CHAT_TOKEN")
 	flag.IntVar(&numOfConsumer, "n", 1, "number of consumers to be spawned")
 	flag.Parse()
 
@@ -57,7 +56,7 @@ func spawnConsumer(n int, quit <-chan os.Signal) {
 	}()
 
 	requestHeader := http.Header{}
-	requestHeader.Set("X-User-Id", strconv.Itoa(userID))
+	requestHeader.Set("Authorization", "Bearer "+token)
 
 	for i := 0; i < n; i++ {
 		wsClient := wsclient.NewClient(serverURI, requestHeader)
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gifff/chat-server/auth"
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/wsclient"
+)
+
+// minSendInterval is the shortest interval between two messages of a sender a
+// ticker keeps up with
+const minSendInterval = time.Millisecond
+
+var (
+	logLevel       string
+	serverURL      string
+	token          string
+	jwtSecret      string
+	firstUserID    int
+	roomID         int
+	numOfSenders   int
+	numOfReceivers int
+	rate           float64
+	duration       time.Duration
+	drainTimeout   time.Duration
+	jsonReport     bool
+	maxP99         time.Duration
+	maxLoss        float64
+)
+
+func main() {
+	flag.StringVar(&logLevel, "log-level", "WARN", "log level. Available options: DEBUG, INFO, WARN, DEBUG")
+	flag.StringVar(&serverURL, "server-url", "http://localhost:8080", "chat server URL")
+	flag.StringVar(&token, "token", os.Getenv("CHAT_TOKEN"), "JWT or API key shared by every connection when -jwt-secret is not set. Defaults to $CHAT_TOKEN")
+	flag.StringVar(&jwtSecret, "jwt-secret", os.Getenv("CHAT_JWT_SECRET"), "HS256 secret to issue a token for a distinct user per connection. Defaults to $CHAT_JWT_SECRET")
+	flag.IntVar(&firstUserID, "first-user-id", 10000, "user id of the first connection when -jwt-secret is set, the next ones are counted up")
+	flag.IntVar(&roomID, "room", 0, "room the messages are sent to, 0 is the global room")
+	flag.IntVar(&numOfSenders, "senders", 1, "number of senders")
+	flag.IntVar(&numOfReceivers, "receivers", 10, "number of receivers")
+	flag.Float64Var(&rate, "rate", 100, "messages per second sent by all the senders together")
+	flag.DurationVar(&duration, "duration", 10*time.Second, "how long the senders send")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 5*time.Second, "how long to wait for the messages still in flight once the senders stop")
+	flag.BoolVar(&jsonReport, "json", false, "print the report as JSON instead of a table")
+	flag.DurationVar(&maxP99, "max-p99", 0, "exit with status 1 when the p99 latency exceeds it. 0 disables the check")
+	flag.Float64Var(&maxLoss, "max-loss", -1, "exit with status 1 when the ratio of lost messages exceeds it, i.e: 0.01. Negative disables the check")
+	flag.Parse()
+
+	log.SetOutput(logger.NewLevelFilter(logLevel, os.Stderr))
+
+	if numOfSenders < 1 || numOfReceivers < 1 || rate <= 0 {
+		log.Fatalf("[ERROR] -senders, -receivers and -rate must be positive")
+	}
+	if sendInterval() < minSendInterval {
+		log.Fatalf("[ERROR] -rate must be at most %.0f messages per second per sender, add -senders to send more", float64(time.Second/minSendInterval))
+	}
+	if token == "" && jwtSecret == "" {
+		log.Fatalf("[ERROR] either -token or -jwt-secret is required")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-quit
+		log.Printf("[INFO] stopping the senders")
+		cancel()
+	}()
+
+	r, err := run(ctx)
+	if err != nil {
+		log.Fatalf("[ERROR] %s", err)
+	}
+
+	if jsonReport {
+		err = r.writeJSON(os.Stdout)
+	} else {
+		err = r.writeTable(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("[ERROR] unable to write the report: %s", err)
+	}
+
+	if failures := r.check(); len(failures) > 0 {
+		for _, failure := range failures {
+			log.Printf("[ERROR] %s", failure)
+		}
+		os.Exit(1)
+	}
+}
+
+// run connects the receivers then the senders, sends at the target rate for
+// the duration and waits for the messages in flight before reporting
+// sendInterval is the interval between two messages of a sender
+func sendInterval() time.Duration {
+	return time.Duration(float64(time.Second) * float64(numOfSenders) / rate)
+}
+
+func run(ctx context.Context) (report, error) {
+	base, err := url.Parse(strings.TrimSuffix(serverURL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return report{}, fmt.Errorf("invalid server URL %q", serverURL)
+	}
+	runID := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	var clients []*wsclient.Client
+	defer func() {
+		for _, client := range clients {
+			_ = client.Stop(time.Second)
+		}
+	}()
+
+	receivers := make([]*receiverStats, numOfReceivers)
+	for i := range receivers {
+		stats := newReceiverStats()
+		receivers[i] = stats
+
+		client, err := connect(ctx, base, firstUserID+numOfSenders+i)
+		if err != nil {
+			return report{}, fmt.Errorf("receiver %d: %w", i, err)
+		}
+		client.AttachMessageTypeObserver(model.TextMessage, func(msg model.Message) {
+			if p, ok := parseProbe(runID, msg.Message); ok {
+				stats.record(p, time.Now())
+			}
+		})
+		clients = append(clients, client)
+	}
+
+	senders := make([]*wsclient.Client, numOfSenders)
+	for i := range senders {
+		client, err := connect(ctx, base, firstUserID+i)
+		if err != nil {
+			return report{}, fmt.Errorf("sender %d: %w", i, err)
+		}
+		senders[i] = client
+		clients = append(clients, client)
+	}
+
+	log.Printf("[INFO] sending %.1f messages per second from %d senders to %d receivers for %s", rate, numOfSenders, numOfReceivers, duration)
+
+	var sent, sendErrors int64
+	sendCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	start := time.Now()
+	interval := sendInterval()
+	wg := sync.WaitGroup{}
+	for i, client := range senders {
+		wg.Add(1)
+		go func(sender int, client *wsclient.Client) {
+			defer wg.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			var seq int64
+			for {
+				select {
+				case <-sendCtx.Done():
+					return
+				case <-ticker.C:
+				}
+
+				seq++
+				p := probe{RunID: runID, Sender: sender, Seq: seq, SentAt: time.Now()}
+				if err := client.SendText(p.String()); err != nil {
+					log.Printf("[DEBUG][Sender: %d] unable to send message %d: %s", sender, seq, err)
+					atomic.AddInt64(&sendErrors, 1)
+					continue
+				}
+				atomic.AddInt64(&sent, 1)
+			}
+		}(i, client)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	drain(ctx, receivers, sent)
+
+	return buildReport(sent, sendErrors, elapsed, receivers), nil
+}
+
+// drain waits until every receiver got every sent message, the drain timeout
+// or the context is done
+func drain(ctx context.Context, receivers []*receiverStats, sent int64) {
+	deadline := time.After(drainTimeout)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		done := true
+		for _, stats := range receivers {
+			if stats.received() < sent {
+				done = false
+				break
+			}
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			log.Printf("[WARN] drain timeout reached with messages still in flight")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// connect joins the room as the user and listens to it
+func connect(ctx context.Context, base *url.URL, userID int) (*wsclient.Client, error) {
+	credential := token
+	if jwtSecret != "" {
+		var err error
+		credential, err = auth.NewJWT([]byte(jwtSecret), userID, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+credential)
+
+	listenURL := *base
+	listenURL.Scheme = strings.Replace(base.Scheme, "http", "ws", 1)
+	listenURL.Path += "/messages/listen"
+	if roomID != 0 {
+		if err := joinRoom(ctx, base, header); err != nil {
+			return nil, err
+		}
+		listenURL.Path = fmt.Sprintf("%s/rooms/%d/messages/listen", base.Path, roomID)
+	}
+
+	client := wsclient.NewClientContext(ctx, listenURL.String(), header)
+	errChan, err := client.Listen()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err, ok := <-errChan; ok && err != nil && ctx.Err() == nil {
+			log.Printf("[WARN] connection of user %d lost: %s", userID, err)
+		}
+	}()
+
+	return client, nil
+}
+
+func joinRoom(ctx context.Context, base *url.URL, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/rooms/%d/members", base, roomID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.New("unable to join the room: " + resp.Status)
+	}
+
+	return nil
+}
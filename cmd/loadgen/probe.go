@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const probePrefix = "loadgen"
+
+// probe is the payload of a message sent by the load generator. It carries
+// everything a receiver needs to measure the latency and detect losses and
+// reordering without asking the senders
+type probe struct {
+	RunID  string
+	Sender int
+	Seq    int64
+	SentAt time.Time
+}
+
+func (p probe) String() string {
+	return fmt.Sprintf("%s:%s:%d:%d:%d", probePrefix, p.RunID, p.Sender, p.Seq, p.SentAt.UnixNano())
+}
+
+// parseProbe decodes the payload and tells whether it is a probe of the run
+func parseProbe(runID string, text string) (probe, bool) {
+	parts := strings.Split(text, ":")
+	if len(parts) != 5 || parts[0] != probePrefix || parts[1] != runID {
+		return probe{}, false
+	}
+
+	sender, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return probe{}, false
+	}
+	seq, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return probe{}, false
+	}
+	sentAt, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil {
+		return probe{}, false
+	}
+
+	return probe{RunID: runID, Sender: sender, Seq: seq, SentAt: time.Unix(0, sentAt)}, true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProbe(t *testing.T) {
+	sentAt := time.Unix(1700000000, 123456789)
+	sent := probe{RunID: "r1", Sender: 3, Seq: 42, SentAt: sentAt}
+
+	testCases := []struct {
+		name   string
+		text   string
+		want   probe
+		wantOK bool
+	}{
+		{name: "round trip", text: sent.String(), want: sent, wantOK: true},
+		{name: "foreign run", text: probe{RunID: "r2", Sender: 3, Seq: 42, SentAt: sentAt}.String()},
+		{name: "plain message", text: "hello"},
+		{name: "empty", text: ""},
+		{name: "other prefix", text: "loadtest:r1:3:42:1700000000123456789"},
+		{name: "missing field", text: "loadgen:r1:3:42"},
+		{name: "extra field", text: "loadgen:r1:3:42:1700000000123456789:x"},
+		{name: "sender not a number", text: "loadgen:r1:x:42:1700000000123456789"},
+		{name: "seq not a number", text: "loadgen:r1:3:x:1700000000123456789"},
+		{name: "seq overflows", text: "loadgen:r1:3:9223372036854775808:1700000000123456789"},
+		{name: "sent at not a number", text: "loadgen:r1:3:42:yesterday"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseProbe("r1", tc.text)
+			if ok != tc.wantOK {
+				t.Fatalf("parseProbe(%q) ok = %t, want %t", tc.text, ok, tc.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.RunID != tc.want.RunID || got.Sender != tc.want.Sender || got.Seq != tc.want.Seq || !got.SentAt.Equal(tc.want.SentAt) {
+				t.Errorf("parseProbe(%q) = %+v, want %+v", tc.text, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// receiverStats collects what one receiver got from every sender
+type receiverStats struct {
+	mu         sync.Mutex
+	seen       map[probeKey]struct{}
+	lastSeq    map[int]int64
+	latencies  []time.Duration
+	duplicates int64
+	reordered  int64
+}
+
+type probeKey struct {
+	sender int
+	seq    int64
+}
+
+func newReceiverStats() *receiverStats {
+	return &receiverStats{
+		seen:    make(map[probeKey]struct{}),
+		lastSeq: make(map[int]int64),
+	}
+}
+
+func (s *receiverStats) record(p probe, receivedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := probeKey{sender: p.Sender, seq: p.Seq}
+	if _, ok := s.seen[key]; ok {
+		s.duplicates++
+		return
+	}
+	s.seen[key] = struct{}{}
+	s.latencies = append(s.latencies, receivedAt.Sub(p.SentAt))
+
+	if p.Seq < s.lastSeq[p.Sender] {
+		s.reordered++
+	} else {
+		s.lastSeq[p.Sender] = p.Seq
+	}
+}
+
+func (s *receiverStats) received() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.seen))
+}
+
+type latencySummary struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+// summarize computes the percentiles of the latencies by nearest rank. It
+// sorts the slice in place
+func summarize(latencies []time.Duration) latencySummary {
+	if len(latencies) == 0 {
+		return latencySummary{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) float64 {
+		rank := int(p*float64(len(latencies))+0.999999) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return milliseconds(latencies[rank])
+	}
+
+	return latencySummary{
+		P50: percentile(0.50),
+		P95: percentile(0.95),
+		P99: percentile(0.99),
+		Max: milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type receiverReport struct {
+	Receiver   int            `json:"receiver"`
+	Received   int64          `json:"received"`
+	Lost       int64          `json:"lost"`
+	Duplicates int64          `json:"duplicates"`
+	Reordered  int64          `json:"reordered"`
+	Latency    latencySummary `json:"latency"`
+}
+
+type report struct {
+	Senders      int              `json:"senders"`
+	Receivers    int              `json:"receivers"`
+	TargetRate   float64          `json:"target_rate"`
+	AchievedRate float64          `json:"achieved_rate"`
+	Duration     float64          `json:"duration_seconds"`
+	Sent         int64            `json:"sent"`
+	SendErrors   int64            `json:"send_errors"`
+	Lost         int64            `json:"lost"`
+	LossRatio    float64          `json:"loss_ratio"`
+	Reordered    int64            `json:"reordered"`
+	Latency      latencySummary   `json:"latency"`
+	PerReceiver  []receiverReport `json:"per_receiver"`
+}
+
+func buildReport(sent int64, sendErrors int64, elapsed time.Duration, receivers []*receiverStats) report {
+	r := report{
+		Senders:      numOfSenders,
+		Receivers:    len(receivers),
+		TargetRate:   rate,
+		AchievedRate: float64(sent) / elapsed.Seconds(),
+		Duration:     elapsed.Seconds(),
+		Sent:         sent,
+		SendErrors:   sendErrors,
+	}
+
+	var all []time.Duration
+	for i, stats := range receivers {
+		stats.mu.Lock()
+		received := int64(len(stats.seen))
+		rr := receiverReport{
+			Receiver:   i,
+			Received:   received,
+			Lost:       sent - received,
+			Duplicates: stats.duplicates,
+			Reordered:  stats.reordered,
+		}
+		all = append(all, stats.latencies...)
+		rr.Latency = summarize(stats.latencies)
+		stats.mu.Unlock()
+
+		r.Lost += rr.Lost
+		r.Reordered += rr.Reordered
+		r.PerReceiver = append(r.PerReceiver, rr)
+	}
+
+	if expected := sent * int64(len(receivers)); expected > 0 {
+		r.LossRatio = float64(r.Lost) / float64(expected)
+	}
+	r.Latency = summarize(all)
+
+	return r
+}
+
+func (r report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r report) writeTable(w io.Writer) error {
+	fmt.Fprintf(w, "senders=%d receivers=%d duration=%.1fs\n", r.Senders, r.Receivers, r.Duration)
+	fmt.Fprintf(w, "rate: target=%.1f/s achieved=%.1f/s\n", r.TargetRate, r.AchievedRate)
+	fmt.Fprintf(w, "sent=%d send_errors=%d lost=%d (%.2f%%) reordered=%d\n", r.Sent, r.SendErrors, r.Lost, r.LossRatio*100, r.Reordered)
+	fmt.Fprintf(w, "latency: p50=%.2fms p95=%.2fms p99=%.2fms max=%.2fms\n\n", r.Latency.P50, r.Latency.P95, r.Latency.P99, r.Latency.Max)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "receiver\treceived\tlost\tduplicates\treordered\tp50 ms\tp95 ms\tp99 ms\t")
+	for _, rr := range r.PerReceiver {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%.2f\t%.2f\t%.2f\t\n",
+			rr.Receiver, rr.Received, rr.Lost, rr.Duplicates, rr.Reordered, rr.Latency.P50, rr.Latency.P95, rr.Latency.P99)
+	}
+
+	return tw.Flush()
+}
+
+// check returns why the run fails the -max-p99 and -max-loss thresholds
+func (r report) check() []string {
+	var failures []string
+	if maxP99 > 0 && r.Latency.P99 > milliseconds(maxP99) {
+		failures = append(failures, fmt.Sprintf("p99 latency %.2fms exceeds %s", r.Latency.P99, maxP99))
+	}
+	if maxLoss >= 0 && r.LossRatio > maxLoss {
+		failures = append(failures, fmt.Sprintf("loss ratio %.4f exceeds %.4f", r.LossRatio, maxLoss))
+	}
+
+	return failures
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	// 1ms to n ms, shuffled so that the sort is exercised
+	latencies := func(n int) []time.Duration {
+		ds := make([]time.Duration, n)
+		for i := range ds {
+			ds[i] = time.Duration((i*7)%n+1) * time.Millisecond
+		}
+		return ds
+	}
+
+	testCases := []struct {
+		name      string
+		latencies []time.Duration
+		want      latencySummary
+	}{
+		{name: "none", latencies: nil, want: latencySummary{}},
+		{name: "one", latencies: []time.Duration{5 * time.Millisecond}, want: latencySummary{P50: 5, P95: 5, P99: 5, Max: 5}},
+		{name: "two", latencies: []time.Duration{2 * time.Millisecond, time.Millisecond}, want: latencySummary{P50: 1, P95: 2, P99: 2, Max: 2}},
+		{name: "ten", latencies: latencies(10), want: latencySummary{P50: 5, P95: 10, P99: 10, Max: 10}},
+		// 0.95 * 20 is not exactly 19 in floating point, the rank must still be 19
+		{name: "twenty", latencies: latencies(20), want: latencySummary{P50: 10, P95: 19, P99: 20, Max: 20}},
+		{name: "hundred", latencies: latencies(100), want: latencySummary{P50: 50, P95: 95, P99: 99, Max: 100}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := summarize(tc.latencies); got != tc.want {
+				t.Errorf("summarize = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReceiverStats(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	testCases := []struct {
+		name           string
+		seqs           []int64
+		wantReceived   int64
+		wantDuplicates int64
+		wantReordered  int64
+	}{
+		{name: "in order", seqs: []int64{1, 2, 3}, wantReceived: 3},
+		{name: "gap", seqs: []int64{1, 3}, wantReceived: 2},
+		{name: "duplicate", seqs: []int64{1, 2, 2, 3}, wantReceived: 3, wantDuplicates: 1},
+		{name: "late", seqs: []int64{1, 3, 2, 4}, wantReceived: 4, wantReordered: 1},
+		// a late message does not move the last sequence back, 4 is in order
+		{name: "late twice", seqs: []int64{3, 1, 2, 4}, wantReceived: 4, wantReordered: 2},
+		{name: "late duplicate", seqs: []int64{1, 2, 1}, wantReceived: 2, wantDuplicates: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := newReceiverStats()
+			for _, seq := range tc.seqs {
+				stats.record(probe{RunID: "r1", Sender: 1, Seq: seq, SentAt: start}, start.Add(time.Millisecond))
+			}
+
+			if got := stats.received(); got != tc.wantReceived {
+				t.Errorf("received = %d, want %d", got, tc.wantReceived)
+			}
+			if stats.duplicates != tc.wantDuplicates || stats.reordered != tc.wantReordered {
+				t.Errorf("duplicates, reordered = %d, %d, want %d, %d", stats.duplicates, stats.reordered, tc.wantDuplicates, tc.wantReordered)
+			}
+		})
+	}
+}
+
+func TestReceiverStatsTracksSendersApart(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	stats := newReceiverStats()
+
+	// the same sequence numbers from two senders are neither duplicates nor late
+	for _, p := range []probe{
+		{Sender: 1, Seq: 5, SentAt: start},
+		{Sender: 2, Seq: 1, SentAt: start},
+		{Sender: 2, Seq: 5, SentAt: start},
+		{Sender: 1, Seq: 6, SentAt: start},
+	} {
+		stats.record(p, start.Add(time.Millisecond))
+	}
+
+	if got := stats.received(); got != 4 {
+		t.Errorf("received = %d, want 4", got)
+	}
+	if stats.duplicates != 0 || stats.reordered != 0 {
+		t.Errorf("duplicates, reordered = %d, %d, want 0, 0", stats.duplicates, stats.reordered)
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	record := func(stats *receiverStats, seq int64, latency time.Duration) {
+		stats.record(probe{Sender: 0, Seq: seq, SentAt: start}, start.Add(latency))
+	}
+
+	complete, lossy := newReceiverStats(), newReceiverStats()
+	for seq := int64(1); seq <= 4; seq++ {
+		record(complete, seq, time.Duration(seq)*time.Millisecond)
+	}
+	record(lossy, 2, 10*time.Millisecond)
+	record(lossy, 1, 20*time.Millisecond)
+	record(lossy, 1, 30*time.Millisecond)
+
+	r := buildReport(4, 1, 2*time.Second, []*receiverStats{complete, lossy})
+
+	if r.Sent != 4 || r.SendErrors != 1 || r.AchievedRate != 2 || r.Receivers != 2 {
+		t.Errorf("report = %+v, want 4 sent, 1 send error, 2/s and 2 receivers", r)
+	}
+	// lossy got 2 of the 4 messages sent, out of 8 expected in total
+	if r.Lost != 2 || r.LossRatio != 0.25 || r.Reordered != 1 {
+		t.Errorf("lost, loss ratio, reordered = %d, %v, %d, want 2, 0.25, 1", r.Lost, r.LossRatio, r.Reordered)
+	}
+
+	want := []receiverReport{
+		{Receiver: 0, Received: 4, Latency: latencySummary{P50: 2, P95: 4, P99: 4, Max: 4}},
+		{Receiver: 1, Received: 2, Lost: 2, Duplicates: 1, Reordered: 1, Latency: latencySummary{P50: 10, P95: 20, P99: 20, Max: 20}},
+	}
+	if len(r.PerReceiver) != len(want) {
+		t.Fatalf("per receiver = %+v, want %+v", r.PerReceiver, want)
+	}
+	for i := range want {
+		if r.PerReceiver[i] != want[i] {
+			t.Errorf("receiver %d = %+v, want %+v", i, r.PerReceiver[i], want[i])
+		}
+	}
+
+	// the overall percentiles are over the latencies of every receiver
+	if want := (latencySummary{P50: 3, P95: 20, P99: 20, Max: 20}); r.Latency != want {
+		t.Errorf("latency = %+v, want %+v", r.Latency, want)
+	}
+}
+
+func TestReportCheck(t *testing.T) {
+	defer func(p99 time.Duration, loss float64) { maxP99, maxLoss = p99, loss }(maxP99, maxLoss)
+
+	r := report{Latency: latencySummary{P99: 12.5}, LossRatio: 0.02}
+
+	testCases := []struct {
+		name         string
+		maxP99       time.Duration
+		maxLoss      float64
+		wantFailures int
+	}{
+		{name: "disabled", maxP99: 0, maxLoss: -1},
+		{name: "within", maxP99: 13 * time.Millisecond, maxLoss: 0.02},
+		{name: "slower", maxP99: 12 * time.Millisecond, maxLoss: -1, wantFailures: 1},
+		{name: "lossier", maxP99: 0, maxLoss: 0.01, wantFailures: 1},
+		{name: "no loss allowed", maxP99: 12 * time.Millisecond, maxLoss: 0, wantFailures: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			maxP99, maxLoss = tc.maxP99, tc.maxLoss
+			if got := r.check(); len(got) != tc.wantFailures {
+				t.Errorf("check() = %q, want %d failures", got, tc.wantFailures)
+			}
+		})
+	}
+}
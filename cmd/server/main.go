@@ -7,42 +7,149 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/gifff/chat-server/auth"
+	"github.com/gifff/chat-server/broker"
 	"github.com/gifff/chat-server/deps"
+	"github.com/gifff/chat-server/idgen"
 	"github.com/gifff/chat-server/logger"
 	"github.com/gifff/chat-server/server"
 	"github.com/gifff/chat-server/server/handlers"
+	"github.com/gifff/chat-server/websocket"
+	"github.com/gifff/chat-server/wsgateway"
 
 	"github.com/labstack/echo"
 )
 
 var (
-	logLevel     string
-	port         int
-	connReporter bool
+	logLevel        string
+	logFormat       string
+	componentLevels string
+	adminUsers      string
+	port            int
+	connReporter    bool
+	store           string
+	dataDir         string
+	authMode        string
+	jwtSecret       string
+	apiKeys         string
+	gatewayOpts     wsgateway.Options
+	sendQueue       websocket.QueueOptions
+	heartbeat       websocket.HeartbeatOptions
+	brokerKind      string
+	redisOpts       broker.RedisOptions
+	idGenerator     string
+	nodeID          int64
+	overflow        string
+	drainTimeout    time.Duration
 )
 
 func main() {
 	flag.StringVar(&logLevel, "log-level", "INFO", "log level. Available options: DEBUG, INFO, WARN, DEBUG")
+	flag.StringVar(&logFormat, "log-format", logger.TextFormat, "log format. Available options: text, json")
+	flag.StringVar(&componentLevels, "log-levels", "", "comma separated component=LEVEL pairs overriding -log-level, i.e: gateway=DEBUG,websocket=WARN")
+	flag.StringVar(&adminUsers, "admin-users", os.Getenv("CHAT_ADMIN_USERS"), "comma separated IDs of the users allowed to change the log levels. Defaults to $CHAT_ADMIN_USERS")
 	flag.IntVar(&port, "port", 8080, "server port")
 	flag.BoolVar(&connReporter, "reporter-enabled", false, "enable total connections reporter that ticks every second")
+	flag.StringVar(&store, "store", deps.MemoryStore, "message store. Available options: memory, file")
+	flag.StringVar(&dataDir, "data-dir", "data", "directory of the data files when -store=file")
+	flag.StringVar(&authMode, "auth", deps.JWTAuth, "authentication. Available options: jwt, apikey")
+	flag.StringVar(&jwtSecret, "jwt-secret", os.Getenv("CHAT_JWT_SECRET"), "HS256 secret when -auth=jwt. Defaults to $CHAT_JWT_SECRET")
+	flag.StringVar(&apiKeys, "api-keys", os.Getenv("CHAT_API_KEYS"), "comma separated key:userID pairs when -auth=apikey. Defaults to $CHAT_API_KEYS")
+	flag.DurationVar(&gatewayOpts.PresenceGracePeriod, "presence-grace-period", wsgateway.DefaultPresenceGracePeriod, "how long a user stays online after their last connection closes")
+	flag.DurationVar(&gatewayOpts.AckTimeout, "ack-timeout", wsgateway.DefaultAckTimeout, "how long a listener in ack mode has to acknowledge a message before it is redelivered")
+	flag.IntVar(&gatewayOpts.MaxDeliveryRetries, "max-delivery-retries", wsgateway.DefaultMaxDeliveryRetries, "redeliveries of an unacknowledged message before it is moved to the offline queue")
+	flag.IntVar(&gatewayOpts.OfflineQueueSize, "offline-queue-size", wsgateway.DefaultOfflineQueueSize, "undelivered messages kept for every user until their next connection")
+	flag.IntVar(&sendQueue.Size, "send-queue-size", websocket.DefaultQueueSize, "messages buffered for every connection before the -send-queue-overflow policy applies")
+	flag.StringVar(&overflow, "send-queue-overflow", string(websocket.DropOldest), "what to do when a send queue is full. Available options: drop-oldest, drop-newest, disconnect")
+	flag.StringVar(&brokerKind, "broker", deps.InProcessBroker, "event fan-out between the server instances. Available options: inprocess, redis")
+	flag.StringVar(&redisOpts.Addr, "redis-addr", "localhost:6379", "redis address when -broker=redis")
+	flag.StringVar(&redisOpts.Password, "redis-password", os.Getenv("CHAT_REDIS_PASSWORD"), "redis password when -broker=redis. Defaults to $CHAT_REDIS_PASSWORD")
+	flag.StringVar(&redisOpts.Channel, "redis-channel", broker.DefaultRedisChannel, "redis pub/sub channel shared by the server instances")
+	flag.DurationVar(&redisOpts.CommandTimeout, "redis-command-timeout", broker.DefaultRedisCommandTimeout, "time limit of every redis command, i.e: a publish")
+	flag.StringVar(&idGenerator, "id-generator", deps.CounterIDs, "message ID generation. Available options: counter, snowflake. Use snowflake with a distinct -node-id on every instance")
+	flag.Int64Var(&nodeID, "node-id", 0, fmt.Sprintf("node ID between 0 and %d when -id-generator=snowflake", idgen.MaxNodeID))
+	flag.DurationVar(&heartbeat.PingInterval, "ping-interval", websocket.DefaultPingInterval, "period of the pings sent to every connection, 0 disables them")
+	flag.DurationVar(&heartbeat.PongTimeout, "pong-timeout", websocket.DefaultPongTimeout, "how long a connection has to answer a ping before it is dropped")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 10*time.Second, "how long the clients have on shutdown to close their connections after the server asked them to reconnect elsewhere")
 	flag.Parse()
 
-	log.SetOutput(logger.NewLevelFilter(logLevel, os.Stdout))
+	defaultLevel, err := logger.ParseLevel(logLevel)
+	if err != nil {
+		log.Fatalf("[ERROR] invalid -log-level: %s", err)
+	}
+	overrides, err := logger.ParseComponentLevels(componentLevels)
+	if err != nil {
+		log.Fatalf("[ERROR] invalid -log-levels: %s", err)
+	}
+	l, err := logger.New(os.Stdout, logFormat, logger.NewLevels(defaultLevel, overrides))
+	if err != nil {
+		log.Fatalf("[ERROR] invalid -log-format: %s", err)
+	}
+	// the packages still logging through the standard logger share the format and the levels
+	log.SetFlags(0)
+	log.SetOutput(logger.NewStdWriter(l))
+
+	admins, err := parseUserIDs(adminUsers)
+	if err != nil {
+		log.Fatalf("[ERROR] invalid -admin-users: %s", err)
+	}
+
 	serverPort := fmt.Sprintf(":%d", port)
 
-	wgw, chatSvc := deps.BuildDependencies()
+	policy, err := websocket.ParseOverflowPolicy(overflow)
+	if err != nil {
+		log.Fatalf("[ERROR] invalid -send-queue-overflow: %s", err)
+	}
+	sendQueue.Overflow = policy
+
+	keys, err := auth.ParseAPIKeys(apiKeys)
+	if err != nil {
+		log.Fatalf("[ERROR] invalid -api-keys: %s", err)
+	}
+
+	d, err := deps.BuildDependencies(deps.Config{
+		Store:     store,
+		DataDir:   dataDir,
+		Auth:      authMode,
+		JWTSecret: jwtSecret,
+		APIKeys:   keys,
+
+		Gateway: gatewayOpts,
+
+		Broker: brokerKind,
+		Redis:  redisOpts,
+
+		IDGenerator: idGenerator,
+		NodeID:      nodeID,
+
+		Logger: l,
+	})
+	if err != nil {
+		log.Fatalf("[ERROR] unable to build dependencies: %s", err)
+	}
+
+	wgw := d.WebsocketGateway
 	hs := handlers.Handlers{
 		WebsocketGateway: wgw,
-		ChatService:      chatSvc,
+		ChatService:      d.ChatService,
+		RoomService:      d.RoomService,
+		UserService:      d.UserService,
+		SendQueue:        sendQueue,
+		Heartbeat:        heartbeat,
+		Metrics:          d.Metrics,
+		Logger:           d.Logger,
+		AdminUserIDs:     admins,
 	}
 
 	_, cancel := context.WithCancel(context.Background())
 
 	e := echo.New()
-	s := server.New(e, serverPort, hs)
+	s := server.New(e, serverPort, hs, d.Authenticator)
 	serverCh := s.Start()
 	log.Printf("[INFO] Chat Server is started at port %d", port)
 
@@ -50,7 +157,9 @@ func main() {
 		go func() {
 			for {
 				<-time.After(1 * time.Second)
-				log.Printf("[INFO] Number of connections: %d", wgw.TotalConnections())
+				totals := wgw.DispatchTotals()
+				log.Printf("[INFO] Number of connections: %d, dropped messages: %d, disconnected slow consumers: %d",
+					wgw.TotalConnections(), totals.Dropped, totals.Disconnected)
 			}
 		}()
 	}
@@ -66,5 +175,31 @@ func main() {
 	log.Printf("[INFO] Shutting down")
 	cancel()
 
+	// echo leaves the hijacked websocket connections alone, /readyz fails from now on
+	if wgw.Drain(drainTimeout) {
+		log.Printf("[INFO] Every connection is closed")
+	}
 	s.Stop(10 * time.Second)
+
+	if err := d.Close(); err != nil {
+		log.Printf("[ERROR] error when closing dependencies: %s", err)
+	}
+}
+
+func parseUserIDs(s string) ([]int, error) {
+	var userIDs []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		userID, err := strconv.Atoi(field)
+		if err != nil || userID < 1 {
+			return nil, fmt.Errorf("invalid user ID %q", field)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gifff/chat-server/auth"
+)
+
+var (
+	secret string
+	userID int
+	ttl    time.Duration
+)
+
+func main() {
+	flag.StringVar(&secret, "jwt-secret", os.Getenv("CHAT_JWT_SECRET"), "HS256 secret shared with the server. Defaults to $CHAT_JWT_SECRET")
+	flag.IntVar(&userID, "user-id", 1, "user id to be embed as the token subject")
+	flag.DurationVar(&ttl, "ttl", 24*time.Hour, "token lifetime. 0 issues a token which never expires")
+	flag.Parse()
+
+	if secret == "" {
+		log.Fatalf("[ERROR] -jwt-secret is required")
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	token, err := auth.NewJWT([]byte(secret), userID, expiresAt)
+	if err != nil {
+		log.Fatalf("[ERROR] unable to sign token: %s", err)
+	}
+
+	fmt.Println(token)
+}
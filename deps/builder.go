@@ -1,20 +1,259 @@
 package deps
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gifff/chat-server/auth"
+	"github.com/gifff/chat-server/broker"
 	"github.com/gifff/chat-server/chatservice"
+	"github.com/gifff/chat-server/idgen"
 	"github.com/gifff/chat-server/interactor"
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/metrics"
+	"github.com/gifff/chat-server/repository"
 	"github.com/gifff/chat-server/wsgateway"
 )
 
-func BuildDependencies() (websocketGateway wsgateway.WebsocketGateway, chatService chatservice.ChatService) {
-	websocketGateway = wsgateway.New()
+const (
+	// MemoryStore keeps the data in memory. Everything is lost on restart.
+	MemoryStore = "memory"
+	// FileStore keeps the data in append-only files under Config.DataDir
+	FileStore = "file"
+
+	// JWTAuth authenticates HS256 signed JSON Web Tokens with Config.JWTSecret
+	JWTAuth = "jwt"
+	// APIKeyAuth authenticates the static Config.APIKeys
+	APIKeyAuth = "apikey"
+
+	// InProcessBroker delivers the events to the connections of this process only
+	InProcessBroker = "inprocess"
+	// RedisBroker fans the events out to every node through Config.Redis
+	RedisBroker = "redis"
+
+	// CounterIDs counts the message IDs up from the highest stored one, for a single node
+	CounterIDs = "counter"
+	// SnowflakeIDs generates time ordered message IDs unique across the nodes of distinct Config.NodeID
+	SnowflakeIDs = "snowflake"
+)
+
+// Config holds the options to build the dependencies.
+// The zero value of Store builds in-memory dependencies.
+type Config struct {
+	Store   string
+	DataDir string
+
+	Auth      string
+	JWTSecret string
+	APIKeys   map[string]int
+
+	Gateway wsgateway.Options
+
+	// Broker zero value builds an in-process broker
+	Broker string
+	Redis  broker.RedisOptions
+
+	// IDGenerator zero value counts the message IDs
+	IDGenerator string
+	NodeID      int64
+
+	// Logger zero value discards the entries
+	Logger logger.Logger
+}
+
+// Dependencies holds the built services
+type Dependencies struct {
+	WebsocketGateway wsgateway.WebsocketGateway
+	ChatService      chatservice.ChatService
+	RoomService      chatservice.RoomService
+	UserService      chatservice.UserService
+	Authenticator    auth.Authenticator
+	// Metrics is shared by every component reporting metrics
+	Metrics metrics.Registry
+	// Logger is the logger passed to the components
+	Logger logger.Logger
+
+	broker       broker.Broker
+	repositories repositories
+}
+
+// Close releases the resources held by the dependencies
+func (d *Dependencies) Close() error {
+	brokerErr := d.broker.Close()
+	if err := d.repositories.close(); err != nil {
+		return err
+	}
+
+	return brokerErr
+}
+
+func BuildDependencies(cfg Config) (*Dependencies, error) {
+	authenticator, err := buildAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := buildRepositories(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := buildIDGenerator(cfg, repos.messages)
+	if err != nil {
+		repos.close()
+		return nil, err
+	}
 
-	messageInteractor := interactor.NewMessageInteractor()
-	rtMessagingInteractor := interactor.NewRealtimeMessagingInteractor(websocketGateway)
-	chatService = chatservice.NewService(
+	l := cfg.Logger
+	if l == nil {
+		l = logger.NewDiscard()
+	}
+
+	b, err := buildBroker(cfg, l)
+	if err != nil {
+		repos.close()
+		return nil, err
+	}
+
+	messageInteractor := interactor.NewMessageInteractor(repos.messages, ids)
+	roomInteractor := interactor.NewRoomInteractor(repos.rooms)
+	userInteractor := interactor.NewUserInteractor(repos.users)
+	readMarkerInteractor := interactor.NewReadMarkerInteractor(repos.readMarkers)
+
+	registry := metrics.NewRegistry()
+	websocketGateway := wsgateway.New(roomInteractor, userInteractor, registry, l, cfg.Gateway)
+
+	// every node, this one included, delivers the published events to its own connections
+	if err := b.Subscribe(broker.GatewayHandler(websocketGateway, l)); err != nil {
+		b.Close()
+		repos.close()
+		return nil, err
+	}
+
+	rtMessagingInteractor := interactor.NewRealtimeMessagingInteractor(b, roomInteractor, l)
+	chatService := chatservice.NewService(
 		messageInteractor,
+		roomInteractor,
+		readMarkerInteractor,
 		rtMessagingInteractor,
 	)
+	roomService := chatservice.NewRoomService(roomInteractor)
+	userService := chatservice.NewUserService(userInteractor, rtMessagingInteractor)
+
+	return &Dependencies{
+		WebsocketGateway: websocketGateway,
+		ChatService:      chatService,
+		RoomService:      roomService,
+		UserService:      userService,
+		Authenticator:    authenticator,
+		Metrics:          registry,
+		Logger:           l,
+		broker:           b,
+		repositories:     repos,
+	}, nil
+}
+
+// repositories holds the stores of the configured kind
+type repositories struct {
+	messages    repository.MessageRepository
+	rooms       repository.RoomRepository
+	users       repository.UserRepository
+	readMarkers repository.ReadMarkerRepository
+}
+
+// close closes every opened repository and returns the first error
+func (r repositories) close() error {
+	var firstErr error
+	for _, c := range []interface{ Close() error }{r.messages, r.rooms, r.users, r.readMarkers} {
+		if c == nil {
+			continue
+		}
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func buildRepositories(cfg Config) (repositories, error) {
+	switch cfg.Store {
+	case "", MemoryStore:
+		return repositories{
+			messages:    repository.NewInMemoryMessageRepository(),
+			rooms:       repository.NewInMemoryRoomRepository(),
+			users:       repository.NewInMemoryUserRepository(),
+			readMarkers: repository.NewInMemoryReadMarkerRepository(),
+		}, nil
+	case FileStore:
+		if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+			return repositories{}, err
+		}
+
+		var repos repositories
+		var err error
+		if repos.messages, err = repository.OpenFileMessageRepository(filepath.Join(cfg.DataDir, "messages.jsonl")); err != nil {
+			return repositories{}, err
+		}
+		if repos.rooms, err = repository.OpenFileRoomRepository(filepath.Join(cfg.DataDir, "rooms.jsonl")); err != nil {
+			repos.close()
+			return repositories{}, err
+		}
+		if repos.users, err = repository.OpenFileUserRepository(filepath.Join(cfg.DataDir, "users.jsonl")); err != nil {
+			repos.close()
+			return repositories{}, err
+		}
+		if repos.readMarkers, err = repository.OpenFileReadMarkerRepository(filepath.Join(cfg.DataDir, "read_markers.jsonl")); err != nil {
+			repos.close()
+			return repositories{}, err
+		}
+
+		return repos, nil
+	default:
+		return repositories{}, fmt.Errorf("unknown store %q", cfg.Store)
+	}
+}
+
+func buildIDGenerator(cfg Config, messages repository.MessageRepository) (idgen.IDGenerator, error) {
+	switch cfg.IDGenerator {
+	case "", CounterIDs:
+		return idgen.NewCounter(messages.LastID()), nil
+	case SnowflakeIDs:
+		return idgen.NewSnowflake(cfg.NodeID)
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", cfg.IDGenerator)
+	}
+}
+
+func buildBroker(cfg Config, l logger.Logger) (broker.Broker, error) {
+	switch cfg.Broker {
+	case "", InProcessBroker:
+		return broker.NewInProcessBroker(), nil
+	case RedisBroker:
+		if cfg.Redis.Addr == "" {
+			return nil, errors.New("redis broker requires an address")
+		}
+		return broker.NewRedisBroker(cfg.Redis, l)
+	default:
+		return nil, fmt.Errorf("unknown broker %q", cfg.Broker)
+	}
+}
 
-	return
+func buildAuthenticator(cfg Config) (auth.Authenticator, error) {
+	switch cfg.Auth {
+	case JWTAuth:
+		if cfg.JWTSecret == "" {
+			return nil, errors.New("jwt auth requires a secret")
+		}
+		return auth.NewJWTAuthenticator([]byte(cfg.JWTSecret)), nil
+	case APIKeyAuth:
+		if len(cfg.APIKeys) == 0 {
+			return nil, errors.New("apikey auth requires at least one key")
+		}
+		return auth.NewAPIKeyAuthenticator(cfg.APIKeys), nil
+	default:
+		return nil, fmt.Errorf("unknown auth %q", cfg.Auth)
+	}
 }
@@ -1,8 +1,67 @@
 package domain
 
+import "time"
+
 // Message entity
 type Message struct {
-	ID      int
+	ID      int64
+	Type    MessageType
 	Message string
 	UserID  int
+	RoomID  int
+	// ToUserID is the recipient of a direct message, it is zero for room messages
+	ToUserID  int
+	CreatedAt time.Time
+	// Revision counts the edits of the message, the original message is revision 0
+	Revision int
+	// EditedAt is the time of the latest edit, it is zero unless the message has been edited
+	EditedAt time.Time
+	// RetractedAt is zero unless the message has been retracted
+	RetractedAt time.Time
+}
+
+// MessageRevision is a superseded body of an edited message
+type MessageRevision struct {
+	Revision  int
+	Message   string
+	CreatedAt time.Time
+}
+
+// IsRetracted tells whether the message has been retracted by its author
+func (m Message) IsRetracted() bool {
+	return !m.RetractedAt.IsZero()
+}
+
+// IsDirect tells whether the message is a direct message between two users
+func (m Message) IsDirect() bool {
+	return m.ToUserID != 0
 }
+
+// IsParticipant tells whether the user is the sender or the recipient of the direct message
+func (m Message) IsParticipant(userID int) bool {
+	return m.UserID == userID || m.ToUserID == userID
+}
+
+// CurrentRevision returns the revision holding the current body of the message
+func (m Message) CurrentRevision() MessageRevision {
+	createdAt := m.CreatedAt
+	if m.Revision > 0 {
+		createdAt = m.EditedAt
+	}
+
+	return MessageRevision{
+		Revision:  m.Revision,
+		Message:   m.Message,
+		CreatedAt: createdAt,
+	}
+}
+
+// MessageType enum type
+type MessageType int
+
+const (
+	// UnknownMessage message type
+	UnknownMessage MessageType = iota
+	// TextMessage message type
+	TextMessage
+)
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// ReadMarker records the highest message ID a user has read in a conversation,
+// either a room or the direct messages with PeerID when it is set
+type ReadMarker struct {
+	UserID    int
+	RoomID    int
+	PeerID    int
+	MessageID int64
+	ReadAt    time.Time
+}
+
+// UnreadCount holds the number of messages of a conversation written by others
+// after the read marker of the user
+type UnreadCount struct {
+	RoomID     int
+	PeerID     int
+	LastReadID int64
+	Unread     int
+}
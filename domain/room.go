@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// GlobalRoomID is the room of the messages sent outside of any created room.
+// Every user is a member of it.
+const GlobalRoomID = 0
+
+// Room entity
+type Room struct {
+	ID        int
+	Name      string
+	CreatedBy int
+	CreatedAt time.Time
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// TypingEvent tells that a user is typing in a room, or to another user when
+// ToUserID is set. It is ephemeral: it is never stored and has no ID.
+type TypingEvent struct {
+	UserID    int
+	RoomID    int
+	ToUserID  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// IsDirect tells whether the user is typing a direct message
+func (e TypingEvent) IsDirect() bool {
+	return e.ToUserID != 0
+}
@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+// User entity holding the profile of a user. Users exist as soon as they
+// authenticate, the profile is only stored once they fill it in.
+type User struct {
+	ID        int
+	Name      string
+	AvatarURL string
+	UpdatedAt time.Time
+}
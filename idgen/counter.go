@@ -0,0 +1,19 @@
+package idgen
+
+import "sync/atomic"
+
+// NewCounter returns an IDGenerator counting up from last, the highest ID already
+// stored, for a single server instance
+func NewCounter(last int64) IDGenerator {
+	return &counter{last: last}
+}
+
+// counter is IDGenerator implementation
+type counter struct {
+	last int64
+}
+
+// NextID implementation
+func (c *counter) NextID() (int64, error) {
+	return atomic.AddInt64(&c.last, 1), nil
+}
@@ -0,0 +1,13 @@
+package idgen
+
+import "errors"
+
+// ErrClockMovedBackwards is returned when the clock has moved back further than a
+// generator can wait for
+var ErrClockMovedBackwards = errors.New("clock moved backwards")
+
+// IDGenerator hands out unique message IDs in ascending order. It is safe for
+// concurrent use.
+type IDGenerator interface {
+	NextID() (int64, error)
+}
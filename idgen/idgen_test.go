@@ -0,0 +1,106 @@
+package idgen
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect draws n IDs from each of the goroutines and fails on duplicates
+func collect(t *testing.T, g IDGenerator, goroutines int, n int) map[int64]bool {
+	t.Helper()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[int64]bool, goroutines*n)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			last := int64(0)
+			for j := 0; j < n; j++ {
+				id, err := g.NextID()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if id <= last {
+					t.Errorf("NextID() = %d after %d, want ascending IDs", id, last)
+				}
+				last = id
+
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("NextID() = %d twice", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return seen
+}
+
+func TestCounterContinuesFromTheLastStoredID(t *testing.T) {
+	seen := collect(t, NewCounter(41), 8, 100)
+
+	for id := int64(42); id < 42+800; id++ {
+		if !seen[id] {
+			t.Fatalf("ID %d was skipped", id)
+		}
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	if _, err := NewSnowflake(MaxNodeID + 1); err == nil {
+		t.Error("accepted a node ID beyond MaxNodeID")
+	}
+
+	g, err := NewSnowflake(MaxNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect(t, g, 8, 1000)
+
+	now := Epoch.Add(time.Hour)
+	s := &snowflake{
+		nodeID: 3,
+		now:    func() time.Time { return now },
+		sleep:  func(d time.Duration) { now = now.Add(d) },
+	}
+
+	first, err := s.NextID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := first, int64(time.Hour/time.Millisecond)<<22|3<<12; got != want {
+		t.Errorf("NextID() = %d, want %d", got, want)
+	}
+
+	// exhausting the sequence waits for the next millisecond
+	for i := 0; i < maxSequence; i++ {
+		if _, err := s.NextID(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next, err := s.NextID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := next, first+1<<22; got != want {
+		t.Errorf("NextID() after the sequence = %d, want %d", got, want)
+	}
+
+	// a small backward step is waited for, a large one fails
+	now = now.Add(-10 * time.Millisecond)
+	if id, err := s.NextID(); err != nil || id <= next {
+		t.Errorf("NextID() after a small backward step = %d, %v, want an ID above %d", id, err, next)
+	}
+	now = now.Add(-time.Minute)
+	if _, err := s.NextID(); err != ErrClockMovedBackwards {
+		t.Errorf("NextID() after a large backward step = %v, want %v", err, ErrClockMovedBackwards)
+	}
+}
@@ -0,0 +1,88 @@
+package idgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+
+	// MaxNodeID is the highest node ID of a Snowflake generator
+	MaxNodeID    = 1<<nodeBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+	maxClockSkew = time.Second
+)
+
+// Epoch is the start of the timestamps of the Snowflake IDs
+var Epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NewSnowflake returns a time ordered IDGenerator which is unique across the
+// server instances as long as each of them has its own node ID. An ID holds,
+// from the most significant bit, 41 bits of milliseconds since Epoch, 10 bits
+// of node ID and 12 bits of sequence within the millisecond.
+func NewSnowflake(nodeID int64) (IDGenerator, error) {
+	if nodeID < 0 || nodeID > MaxNodeID {
+		return nil, fmt.Errorf("node ID must be between 0 and %d", MaxNodeID)
+	}
+
+	return &snowflake{
+		nodeID: nodeID,
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}, nil
+}
+
+// snowflake is IDGenerator implementation
+type snowflake struct {
+	nodeID int64
+	now    func() time.Time
+	sleep  func(time.Duration)
+
+	mu       sync.Mutex
+	lastTick int64
+	sequence int64
+}
+
+// NextID implementation
+func (s *snowflake) NextID() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tick := s.tick()
+	if tick < s.lastTick {
+		// wait for a small skew to catch up rather than hand out a smaller ID
+		skew := time.Duration(s.lastTick-tick) * time.Millisecond
+		if skew > maxClockSkew {
+			return 0, ErrClockMovedBackwards
+		}
+		s.sleep(skew)
+
+		if tick = s.tick(); tick < s.lastTick {
+			return 0, ErrClockMovedBackwards
+		}
+	}
+
+	if tick == s.lastTick {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			// the sequence of this millisecond is exhausted
+			for tick <= s.lastTick {
+				s.sleep(time.Millisecond)
+				tick = s.tick()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastTick = tick
+
+	return tick<<(nodeBits+sequenceBits) | s.nodeID<<sequenceBits | s.sequence, nil
+}
+
+// tick returns the milliseconds elapsed since Epoch
+func (s *snowflake) tick() int64 {
+	return s.now().Sub(Epoch).Milliseconds()
+}
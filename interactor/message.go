@@ -1,31 +1,96 @@
 package interactor
 
 import (
+	"time"
+
 	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/idgen"
+	"github.com/gifff/chat-server/repository"
 )
 
 type MessageInteractor interface {
-	Create(message string, userID int) domain.Message
+	// Create stores the draft as a new text message, assigning its ID and creation time
+	Create(draft domain.Message) (domain.Message, error)
+	Get(id int64) (domain.Message, error)
+	Retract(id int64) (domain.Message, error)
+	Edit(id int64, message string) (domain.Message, error)
+	Revisions(id int64) ([]domain.MessageRevision, error)
+	List(query repository.MessageQuery) (messages []domain.Message, hasMore bool, err error)
+	CountAfter(query repository.MessageQuery, excludedUserID int) (int, error)
+	Peers(userID int) ([]int, error)
 }
 
-func NewMessageInteractor() MessageInteractor {
+func NewMessageInteractor(messageRepository repository.MessageRepository, ids idgen.IDGenerator) MessageInteractor {
 	return &messageInteractor{
-		nextMessageID: 1,
+		messageRepository: messageRepository,
+		ids:               ids,
 	}
 }
 
 type messageInteractor struct {
-	nextMessageID int
+	messageRepository repository.MessageRepository
+	ids               idgen.IDGenerator
+}
+
+func (m *messageInteractor) Create(draft domain.Message) (domain.Message, error) {
+	id, err := m.ids.NextID()
+	if err != nil {
+		return domain.Message{}, err
+	}
+
+	msg := draft
+	msg.ID = id
+	msg.Type = domain.TextMessage
+	msg.CreatedAt = time.Now()
+
+	if err := m.messageRepository.Insert(msg); err != nil {
+		return domain.Message{}, err
+	}
+
+	return msg, nil
+}
+
+func (m *messageInteractor) Get(id int64) (domain.Message, error) {
+	return m.messageRepository.Get(id)
+}
+
+func (m *messageInteractor) Retract(id int64) (domain.Message, error) {
+	return m.messageRepository.Retract(id, time.Now())
 }
 
-func (m *messageInteractor) Create(message string, userID int) domain.Message {
-	msg := domain.Message{
-		ID:      m.nextMessageID,
-		Message: message,
-		UserID:  userID,
+func (m *messageInteractor) Edit(id int64, message string) (domain.Message, error) {
+	return m.messageRepository.Edit(id, message, time.Now())
+}
+
+func (m *messageInteractor) Revisions(id int64) ([]domain.MessageRevision, error) {
+	return m.messageRepository.Revisions(id)
+}
+
+func (m *messageInteractor) List(query repository.MessageQuery) ([]domain.Message, bool, error) {
+	limit := query.Limit
+	// fetch one extra message to find out whether there is another page
+	query.Limit++
+
+	messages, err := m.messageRepository.List(query)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(messages) <= limit {
+		return messages, false, nil
+	}
+
+	if query.Forward {
+		return messages[:limit], true, nil
 	}
 
-	m.nextMessageID++
+	return messages[1:], true, nil
+}
+
+func (m *messageInteractor) CountAfter(query repository.MessageQuery, excludedUserID int) (int, error) {
+	return m.messageRepository.CountAfter(query, excludedUserID)
+}
 
-	return msg
+func (m *messageInteractor) Peers(userID int) ([]int, error) {
+	return m.messageRepository.Peers(userID)
 }
@@ -0,0 +1,40 @@
+package interactor
+
+import (
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+type ReadMarkerInteractor interface {
+	// MarkRead stamps and stores the marker unless it is behind the stored one,
+	// and tells whether it did
+	MarkRead(marker domain.ReadMarker) (domain.ReadMarker, bool, error)
+	List(userID int) ([]domain.ReadMarker, error)
+}
+
+func NewReadMarkerInteractor(readMarkerRepository repository.ReadMarkerRepository) ReadMarkerInteractor {
+	return readMarkerInteractor{
+		readMarkerRepository: readMarkerRepository,
+	}
+}
+
+type readMarkerInteractor struct {
+	readMarkerRepository repository.ReadMarkerRepository
+}
+
+func (r readMarkerInteractor) MarkRead(marker domain.ReadMarker) (domain.ReadMarker, bool, error) {
+	marker.ReadAt = time.Now()
+
+	advanced, err := r.readMarkerRepository.Advance(marker)
+	if err != nil {
+		return domain.ReadMarker{}, false, err
+	}
+
+	return marker, advanced, nil
+}
+
+func (r readMarkerInteractor) List(userID int) ([]domain.ReadMarker, error) {
+	return r.readMarkerRepository.List(userID)
+}
@@ -1,22 +1,96 @@
 package interactor
 
 import (
+	"github.com/gifff/chat-server/broker"
 	"github.com/gifff/chat-server/domain"
-	"github.com/gifff/chat-server/wsgateway"
+	"github.com/gifff/chat-server/logger"
 )
 
 type RealtimeMessagingInteractor interface {
 	DeliverMessage(message domain.Message)
+	DeliverDirectMessage(message domain.Message)
+	DeliverRetraction(message domain.Message)
+	DeliverEdit(message domain.Message)
+	DeliverUserUpdate(user domain.User)
+	DeliverTyping(event domain.TypingEvent)
+	DeliverReadReceipt(marker domain.ReadMarker, authorID int)
 }
 
-func NewRealtimeMessagingInteractor(websocketGateway wsgateway.WebsocketGateway) RealtimeMessagingInteractor {
-	return realtimeMessagingInteractor{websocketGateway}
+// NewRealtimeMessagingInteractor returns the interactor publishing the events to
+// the broker, whose subscribers deliver them to the connections of every node.
+// The events about a room carry its members as known to the room interactor.
+// The entries of l are logged as the broker component.
+func NewRealtimeMessagingInteractor(b broker.Broker, roomInteractor RoomInteractor, l logger.Logger) RealtimeMessagingInteractor {
+	return realtimeMessagingInteractor{
+		broker:         b,
+		roomInteractor: roomInteractor,
+		log:            l.Component("broker"),
+	}
 }
 
 type realtimeMessagingInteractor struct {
-	websocketGateway wsgateway.WebsocketGateway
+	broker         broker.Broker
+	roomInteractor RoomInteractor
+	log            logger.Logger
+}
+
+func (r realtimeMessagingInteractor) publish(event broker.Event) {
+	if err := r.broker.Publish(event); err != nil {
+		r.log.Errorf("Unable to publish %q event: %v", event.Kind, err)
+	}
+}
+
+// publishToRoom publishes the event about the room with the members of the room
+func (r realtimeMessagingInteractor) publishToRoom(event broker.Event, roomID int) {
+	members, err := r.roomInteractor.Members(roomID)
+	if err != nil {
+		r.log.Errorf("Unable to list the members of room %d for %q event: %v", roomID, event.Kind, err)
+		return
+	}
+
+	event.Members = members
+	r.publish(event)
+}
+
+// publishAbout publishes the event about the message to its room, unless it is direct
+func (r realtimeMessagingInteractor) publishAbout(event broker.Event, message domain.Message) {
+	if message.IsDirect() {
+		r.publish(event)
+		return
+	}
+
+	r.publishToRoom(event, message.RoomID)
 }
 
 func (r realtimeMessagingInteractor) DeliverMessage(message domain.Message) {
-	r.websocketGateway.EnqueueMessageBroadcast(message.ID, message.Message, message.UserID)
+	r.publishToRoom(broker.Event{Kind: broker.MessageEvent, Message: &message}, message.RoomID)
+}
+
+func (r realtimeMessagingInteractor) DeliverDirectMessage(message domain.Message) {
+	r.publish(broker.Event{Kind: broker.DirectMessageEvent, Message: &message})
+}
+
+func (r realtimeMessagingInteractor) DeliverRetraction(message domain.Message) {
+	r.publishAbout(broker.Event{Kind: broker.RetractionEvent, Message: &message}, message)
+}
+
+func (r realtimeMessagingInteractor) DeliverEdit(message domain.Message) {
+	r.publishAbout(broker.Event{Kind: broker.EditEvent, Message: &message}, message)
+}
+
+func (r realtimeMessagingInteractor) DeliverUserUpdate(user domain.User) {
+	r.publish(broker.Event{Kind: broker.UserUpdateEvent, User: &user})
+}
+
+func (r realtimeMessagingInteractor) DeliverTyping(event domain.TypingEvent) {
+	if event.IsDirect() {
+		r.publish(broker.Event{Kind: broker.TypingEvent, Typing: &event})
+		return
+	}
+
+	r.publishToRoom(broker.Event{Kind: broker.TypingEvent, Typing: &event}, event.RoomID)
+}
+
+func (r realtimeMessagingInteractor) DeliverReadReceipt(marker domain.ReadMarker, authorID int) {
+	r.publish(broker.Event{Kind: broker.ReadReceiptEvent, ReadMarker: &marker, AuthorID: authorID})
 }
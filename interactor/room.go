@@ -0,0 +1,94 @@
+package interactor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+type RoomInteractor interface {
+	Create(name string, userID int) (domain.Room, error)
+	Get(id int) (domain.Room, error)
+	List() ([]domain.Room, error)
+	Join(roomID int, userID int) error
+	Leave(roomID int, userID int) error
+	IsMember(roomID int, userID int) bool
+	Members(roomID int) ([]int, error)
+}
+
+func NewRoomInteractor(roomRepository repository.RoomRepository) RoomInteractor {
+	return &roomInteractor{
+		roomRepository: roomRepository,
+		nextRoomID:     roomRepository.LastID() + 1,
+	}
+}
+
+type roomInteractor struct {
+	mu             sync.Mutex
+	roomRepository repository.RoomRepository
+	nextRoomID     int
+}
+
+// Create stores a new room with the creator as its first member
+func (r *roomInteractor) Create(name string, userID int) (domain.Room, error) {
+	r.mu.Lock()
+	room := domain.Room{
+		ID:        r.nextRoomID,
+		Name:      name,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+
+	err := r.roomRepository.Insert(room)
+	if err == nil {
+		r.nextRoomID++
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		return domain.Room{}, err
+	}
+
+	if err := r.roomRepository.AddMember(room.ID, userID); err != nil {
+		return domain.Room{}, err
+	}
+
+	return room, nil
+}
+
+func (r *roomInteractor) Get(id int) (domain.Room, error) {
+	return r.roomRepository.Get(id)
+}
+
+func (r *roomInteractor) List() ([]domain.Room, error) {
+	return r.roomRepository.List()
+}
+
+func (r *roomInteractor) Join(roomID int, userID int) error {
+	return r.roomRepository.AddMember(roomID, userID)
+}
+
+func (r *roomInteractor) Leave(roomID int, userID int) error {
+	return r.roomRepository.RemoveMember(roomID, userID)
+}
+
+// IsMember tells whether the user is a member of the room. Everyone is a member of the global room.
+func (r *roomInteractor) IsMember(roomID int, userID int) bool {
+	if roomID == domain.GlobalRoomID {
+		return true
+	}
+
+	return r.roomRepository.IsMember(roomID, userID)
+}
+
+// Members returns the IDs of the members of the room in ascending order. The
+// global room has no member list, it is nil.
+func (r *roomInteractor) Members(roomID int) ([]int, error) {
+	if roomID == domain.GlobalRoomID {
+		return nil, nil
+	}
+
+	return r.roomRepository.Members(roomID)
+}
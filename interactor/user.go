@@ -0,0 +1,49 @@
+package interactor
+
+import (
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+type UserInteractor interface {
+	Get(id int) (domain.User, error)
+	// Profile returns the stored profile of the user, or a profile holding only
+	// the ID when the user has not filled it in
+	Profile(id int) domain.User
+	// Update stores the profile, stamping its update time
+	Update(user domain.User) (domain.User, error)
+}
+
+func NewUserInteractor(userRepository repository.UserRepository) UserInteractor {
+	return userInteractor{
+		userRepository: userRepository,
+	}
+}
+
+type userInteractor struct {
+	userRepository repository.UserRepository
+}
+
+func (u userInteractor) Get(id int) (domain.User, error) {
+	return u.userRepository.Get(id)
+}
+
+func (u userInteractor) Profile(id int) domain.User {
+	user, err := u.userRepository.Get(id)
+	if err != nil {
+		return domain.User{ID: id}
+	}
+
+	return user
+}
+
+func (u userInteractor) Update(user domain.User) (domain.User, error) {
+	user.UpdatedAt = time.Now()
+	if err := u.userRepository.Put(user); err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
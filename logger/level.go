@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	// DebugLevel entries trace the normal operation, i.e: every dispatched message
+	DebugLevel Level = iota
+	// InfoLevel entries report the notable events of the normal operation
+	InfoLevel
+	// WarnLevel entries report the failures the server recovers from
+	WarnLevel
+	// ErrorLevel entries report the failures which need attention
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARN"
+	case ErrorLevel:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// ParseLevel parses the level name, case insensitively
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return DebugLevel, nil
+	case "INFO":
+		return InfoLevel, nil
+	case "WARN":
+		return WarnLevel, nil
+	case "ERROR":
+		return ErrorLevel, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q. Available options: DEBUG, INFO, WARN, ERROR", s)
+	}
+}
+
+// ParseComponentLevels parses comma separated component=LEVEL pairs, i.e: gateway=DEBUG,websocket=WARN
+func ParseComponentLevels(s string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid component level %q, expected component=LEVEL", pair)
+		}
+
+		level, err := ParseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(parts[0])] = level
+	}
+
+	return levels, nil
+}
+
+// Levels holds the minimum level of the logged entries, for every component
+// without a level of its own and per component. It is safe for concurrent use,
+// so that the levels can be changed while the server runs.
+type Levels interface {
+	// Level returns the level of the component, or the default one
+	Level(component string) Level
+	// SetDefault sets the level of the components without a level of their own
+	SetDefault(level Level)
+	// SetLevel overrides the level of the component
+	SetLevel(component string, level Level)
+	// ResetLevel makes the component use the default level again
+	ResetLevel(component string)
+	// Default returns the level of the components without a level of their own
+	Default() Level
+	// Components returns the overridden levels by component
+	Components() map[string]Level
+}
+
+// NewLevels returns Levels with the default level and the level overrides of the components
+func NewLevels(defaultLevel Level, components map[string]Level) Levels {
+	l := &levels{
+		defaultLevel: defaultLevel,
+		components:   make(map[string]Level, len(components)),
+	}
+	for component, level := range components {
+		l.components[component] = level
+	}
+
+	return l
+}
+
+// levels is Levels implementation
+type levels struct {
+	mu           sync.RWMutex
+	defaultLevel Level
+	components   map[string]Level
+}
+
+// Level implementation
+func (l *levels) Level(component string) Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if level, ok := l.components[component]; ok {
+		return level
+	}
+
+	return l.defaultLevel
+}
+
+// SetDefault implementation
+func (l *levels) SetDefault(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.defaultLevel = level
+}
+
+// SetLevel implementation
+func (l *levels) SetLevel(component string, level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.components[component] = level
+}
+
+// ResetLevel implementation
+func (l *levels) ResetLevel(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.components, component)
+}
+
+// Default implementation
+func (l *levels) Default() Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.defaultLevel
+}
+
+// Components implementation
+func (l *levels) Components() map[string]Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	components := make(map[string]Level, len(l.components))
+	for component, level := range l.components {
+		components[component] = level
+	}
+
+	return components
+}
@@ -0,0 +1,227 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fields are the structured context of the log entries
+type Fields map[string]interface{}
+
+// The names of the fields shared by the components
+const (
+	ComponentField    = "component"
+	UserIDField       = "user_id"
+	ConnectionIDField = "conn_id"
+	MessageIDField    = "message_id"
+	RequestIDField    = "request_id"
+)
+
+const (
+	// TextFormat writes an entry per line as the standard log package does, with the fields as key=value pairs
+	TextFormat = "text"
+	// JSONFormat writes an entry per line as a JSON object
+	JSONFormat = "json"
+)
+
+// Logger writes leveled entries with structured fields
+type Logger interface {
+	// With returns a logger adding the fields to every entry
+	With(fields Fields) Logger
+	// Component returns a logger of the component, its entries are filtered by the level of the component
+	Component(name string) Logger
+	// Enabled tells whether the entries of the level are written, to skip building costly ones
+	Enabled(level Level) bool
+	// Levels returns the levels shared by the logger and the loggers derived from it
+	Levels() Levels
+
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// ErrUnknownFormat is returned by New for formats other than TextFormat and JSONFormat
+var ErrUnknownFormat = fmt.Errorf("unknown log format. Available options: %s, %s", TextFormat, JSONFormat)
+
+// New returns Logger writing the entries to w in the format, filtered by the levels
+func New(w io.Writer, format string, levels Levels) (Logger, error) {
+	switch format {
+	case "", TextFormat:
+		format = TextFormat
+	case JSONFormat:
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	return &logger{
+		out:    &output{w: w, format: format, now: time.Now},
+		levels: levels,
+	}, nil
+}
+
+// NewDiscard returns Logger which writes nothing
+func NewDiscard() Logger {
+	l, _ := New(ioutil.Discard, TextFormat, NewLevels(ErrorLevel, nil))
+	return l
+}
+
+// output serializes the writes of every logger derived from the same one
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	now    func() time.Time
+}
+
+// logger is Logger implementation
+type logger struct {
+	out       *output
+	levels    Levels
+	component string
+	fields    Fields
+}
+
+// With implementation
+func (l *logger) With(fields Fields) Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	return &logger{out: l.out, levels: l.levels, component: l.component, fields: merged}
+}
+
+// Component implementation
+func (l *logger) Component(name string) Logger {
+	return &logger{out: l.out, levels: l.levels, component: name, fields: l.fields}
+}
+
+// Enabled implementation
+func (l *logger) Enabled(level Level) bool {
+	return level >= l.levels.Level(l.component)
+}
+
+// Levels implementation
+func (l *logger) Levels() Levels {
+	return l.levels
+}
+
+// Debugf implementation
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.log(DebugLevel, format, args)
+}
+
+// Infof implementation
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.log(InfoLevel, format, args)
+}
+
+// Warnf implementation
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.log(WarnLevel, format, args)
+}
+
+// Errorf implementation
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.log(ErrorLevel, format, args)
+}
+
+func (l *logger) log(level Level, format string, args []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
+	}
+	l.out.write(level, l.component, msg, l.fields)
+}
+
+func (o *output) write(level Level, component string, msg string, fields Fields) {
+	var b bytes.Buffer
+	now := o.now()
+	if o.format == JSONFormat {
+		writeJSON(&b, now, level, component, msg, fields)
+	} else {
+		writeText(&b, now, level, component, msg, fields)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, _ = o.w.Write(b.Bytes())
+}
+
+// writeText writes i.e: 2020/01/02 15:04:05 [INFO] [gateway] message user_id=1 conn_id=2
+func writeText(b *bytes.Buffer, now time.Time, level Level, component string, msg string, fields Fields) {
+	b.WriteString(now.Format("2006/01/02 15:04:05"))
+	b.WriteString(" [")
+	b.WriteString(level.String())
+	b.WriteString("] ")
+	if component != "" {
+		b.WriteString("[")
+		b.WriteString(component)
+		b.WriteString("] ")
+	}
+	b.WriteString(strings.TrimRight(msg, "\n"))
+
+	for _, key := range sortedKeys(fields) {
+		value := fmt.Sprint(fields[key])
+		if strings.ContainsAny(value, " \"=\n") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" ")
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(value)
+	}
+	b.WriteString("\n")
+}
+
+// writeJSON writes i.e: {"time":"...","level":"INFO","component":"gateway","msg":"message","user_id":1}
+func writeJSON(b *bytes.Buffer, now time.Time, level Level, component string, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+4)
+	for key, value := range fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	entry["time"] = now.UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = strings.TrimRight(msg, "\n")
+	if component != "" {
+		entry[ComponentField] = component
+	}
+
+	// encoding/json writes the keys of a map in ascending order and ends the entry with a newline
+	if err := json.NewEncoder(b).Encode(entry); err != nil {
+		b.Reset()
+		fmt.Fprintf(b, `{"time":%q,"level":"ERROR","msg":%q}`+"\n", now.UTC().Format(time.RFC3339Nano), "unable to encode log entry: "+err.Error())
+	}
+}
+
+// sortedKeys returns the keys of the fields in ascending order, so that the
+// entries are written the same way every time
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(t *testing.T, format string, levels Levels) (*logger, *bytes.Buffer) {
+	t.Helper()
+
+	var b bytes.Buffer
+	l, err := New(&b, format, levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	concrete := l.(*logger)
+	concrete.out.now = func() time.Time {
+		return time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	}
+
+	return concrete, &b
+}
+
+func TestTextFormat(t *testing.T) {
+	l, b := newTestLogger(t, TextFormat, NewLevels(DebugLevel, nil))
+
+	l.Component("gateway").With(Fields{UserIDField: 1, ConnectionIDField: 2}).Infof("Writing %s message", "text")
+	l.With(Fields{"reason": "slow consumer"}).Warnf("Disconnecting")
+
+	want := "2020/01/02 15:04:05 [INFO] [gateway] Writing text message conn_id=2 user_id=1\n" +
+		"2020/01/02 15:04:05 [WARN] Disconnecting reason=\"slow consumer\"\n"
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%swant:\n%s", got, want)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	l, b := newTestLogger(t, JSONFormat, NewLevels(DebugLevel, nil))
+
+	l.Component("websocket").With(Fields{MessageIDField: int64(42), "error": errors.New("broken pipe")}).Errorf("Unable to write")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, b)
+	}
+	want := map[string]interface{}{
+		"time":         "2020-01-02T15:04:05Z",
+		"level":        "ERROR",
+		"component":    "websocket",
+		"msg":          "Unable to write",
+		MessageIDField: float64(42),
+		"error":        "broken pipe",
+	}
+	if len(entry) != len(want) {
+		t.Errorf("got %v, want %v", entry, want)
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	levels := NewLevels(InfoLevel, map[string]Level{"gateway": DebugLevel})
+	l, b := newTestLogger(t, TextFormat, levels)
+	gateway := l.Component("gateway")
+	websocket := l.Component("websocket")
+
+	gateway.Debugf("gateway debug")
+	websocket.Debugf("websocket debug")
+	websocket.Infof("websocket info")
+
+	// the derived loggers follow the changes at runtime
+	levels.SetLevel("websocket", ErrorLevel)
+	levels.ResetLevel("gateway")
+	gateway.Debugf("gateway debug after reset")
+	websocket.Warnf("websocket warn after raise")
+
+	got := b.String()
+	for _, want := range []string{"gateway debug\n", "websocket info\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"websocket debug", "after reset", "after raise"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("unexpected %q in:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels("gateway=debug, websocket=WARN,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 || levels["gateway"] != DebugLevel || levels["websocket"] != WarnLevel {
+		t.Errorf("ParseComponentLevels() = %v", levels)
+	}
+
+	for _, invalid := range []string{"gateway", "=DEBUG", "gateway=LOUD"} {
+		if _, err := ParseComponentLevels(invalid); err == nil {
+			t.Errorf("ParseComponentLevels(%q) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestStdWriter(t *testing.T) {
+	l, b := newTestLogger(t, TextFormat, NewLevels(InfoLevel, nil))
+	std := log.New(NewStdWriter(l), "", 0)
+
+	std.Printf("[DEBUG] filtered out")
+	std.Printf("[WARN] Redis subscription lost")
+	std.Printf("without level")
+
+	want := "2020/01/02 15:04:05 [WARN] Redis subscription lost\n" +
+		"2020/01/02 15:04:05 [INFO] without level\n"
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%swant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"io"
+	"strings"
+)
+
+// NewStdWriter returns a writer for the standard log package which writes its
+// entries through l, so that the packages still using it share the format and
+// the levels. The [DEBUG], [INFO], [WARN] or [ERROR] prefix of an entry sets
+// its level, INFO without one. Set the flags of the standard logger to 0, the
+// time is written by l.
+func NewStdWriter(l Logger) io.Writer {
+	return stdWriter{logger: l}
+}
+
+type stdWriter struct {
+	logger Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+
+	level := InfoLevel
+	if strings.HasPrefix(msg, "[") {
+		if end := strings.Index(msg, "]"); end > 0 {
+			if parsed, err := ParseLevel(msg[1:end]); err == nil {
+				level = parsed
+				msg = strings.TrimSpace(msg[end+1:])
+			}
+		}
+	}
+
+	switch level {
+	case DebugLevel:
+		w.logger.Debugf("%s", msg)
+	case InfoLevel:
+		w.logger.Infof("%s", msg)
+	case WarnLevel:
+		w.logger.Warnf("%s", msg)
+	default:
+		w.logger.Errorf("%s", msg)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	counterKind   = "counter"
+	gaugeKind     = "gauge"
+	histogramKind = "histogram"
+)
+
+// family is a metric and its series, one for every combination of label values.
+// Every family has its own lock, so that recording a metric never waits on
+// the others.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// counts, sum and value as the count are used by the histograms, counts[i]
+	// is the number of observations not greater than buckets[i]
+	counts []uint64
+	sum    float64
+}
+
+func newFamily(name string, help string, kind string, labels []string, buckets []float64) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	if len(labels) == 0 {
+		// the metrics without labels are exposed even before being recorded
+		f.get()
+	}
+
+	return f
+}
+
+// get returns the series of the label values, f.mu must be held
+func (f *family) get(labelValues ...string) *series {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues}
+		if f.kind == histogramKind {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// add moves the counter or gauge by delta and returns its new value
+func (f *family) add(delta float64, labelValues ...string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.get(labelValues...)
+	s.value += delta
+
+	return s.value
+}
+
+func (f *family) observe(v float64, labelValues ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.get(labelValues...)
+	s.value++
+	s.sum += v
+	for i, upperBound := range f.buckets {
+		if v <= upperBound {
+			s.counts[i]++
+		}
+	}
+}
+
+func (f *family) write(w io.Writer) error {
+	f.mu.Lock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != histogramKind {
+			fmt.Fprintf(&b, "%s%s %s\n", f.name, f.labelPairs(s.labelValues, ""), formatValue(s.value))
+			continue
+		}
+
+		for i, upperBound := range f.buckets {
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, f.labelPairs(s.labelValues, formatValue(upperBound)), s.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %s\n", f.name, f.labelPairs(s.labelValues, "+Inf"), formatValue(s.value))
+		fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, f.labelPairs(s.labelValues, ""), formatValue(s.sum))
+		fmt.Fprintf(&b, "%s_count%s %s\n", f.name, f.labelPairs(s.labelValues, ""), formatValue(s.value))
+	}
+	f.mu.Unlock()
+
+	// the slow reader of the scrape does not hold the recording back
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelPairs formats the labels of the series, le is the bucket upper bound of a histogram if any
+func (f *family) labelPairs(labelValues []string, le string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, value := range labelValues {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escapeLabelValue(value)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"io"
+	"time"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// Metrics records what the components of the server observe
+type Metrics interface {
+	// ConnectionOpened and ConnectionClosed track the registered websocket
+	// connections, the user ID is only used to count the connected users
+	ConnectionOpened(userID int)
+	ConnectionClosed(userID int)
+	// MessageReceived counts a message read from a client
+	MessageReceived(messageType model.MessageType)
+	// MessageDelivered counts a message dispatched to a connection
+	MessageDelivered(messageType model.MessageType)
+	// MessageDropped counts a message dispatched to a connection but never queued for writing
+	MessageDropped()
+	// QueueDepthChanged moves the number of messages waiting in the send queues by delta
+	QueueDepthChanged(delta int)
+	// MessageWritten observes a write to a connection, err is the write error if any
+	MessageWritten(latency time.Duration, err error)
+	// UpgradeFailed counts a failed websocket handshake
+	UpgradeFailed()
+	// RequestHandled observes an HTTP request by its route pattern
+	RequestHandled(method string, route string, status int, duration time.Duration)
+}
+
+// Registry keeps the recorded metrics in memory for Prometheus to scrape
+type Registry interface {
+	Metrics
+	// Expose writes every metric in the Prometheus text exposition format
+	Expose(w io.Writer) error
+}
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewNoop returns Metrics which records nothing
+func NewNoop() Metrics {
+	return noop{}
+}
+
+// noop is Metrics implementation which discards everything
+type noop struct{}
+
+func (noop) ConnectionOpened(int)                              {}
+func (noop) ConnectionClosed(int)                              {}
+func (noop) MessageReceived(model.MessageType)                 {}
+func (noop) MessageDelivered(model.MessageType)                {}
+func (noop) MessageDropped()                                   {}
+func (noop) QueueDepthChanged(int)                             {}
+func (noop) MessageWritten(time.Duration, error)               {}
+func (noop) UpgradeFailed()                                    {}
+func (noop) RequestHandled(string, string, int, time.Duration) {}
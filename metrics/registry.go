@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// NewRegistry returns Registry of the chat server metrics
+func NewRegistry() Registry {
+	r := &registry{connectionsByUser: make(map[int]int)}
+
+	r.activeConnections = r.register("chat_connections_active", "Websocket connections currently registered.", gaugeKind, nil, nil)
+	r.connectedUsers = r.register("chat_users_connected", "Users with at least one websocket connection registered.", gaugeKind, nil, nil)
+	r.received = r.register("chat_messages_received_total", "Messages read from the clients by type.", counterKind, []string{"type"}, nil)
+	r.delivered = r.register("chat_messages_delivered_total", "Messages dispatched to the connections by type.", counterKind, []string{"type"}, nil)
+	r.dropped = r.register("chat_messages_dropped_total", "Messages dispatched to the connections but never queued for writing.", counterKind, nil, nil)
+	r.queueDepth = r.register("chat_dispatch_queue_depth", "Messages waiting in the send queues of the connections.", gaugeKind, nil, nil)
+	r.writeErrors = r.register("chat_write_errors_total", "Failed writes to the connections.", counterKind, nil, nil)
+	r.writeDuration = r.register("chat_write_duration_seconds", "Duration of the writes to the connections.", histogramKind, nil, DefaultBuckets)
+	r.upgradeFailures = r.register("chat_websocket_upgrade_failures_total", "Failed websocket handshakes.", counterKind, nil, nil)
+	r.requestDuration = r.register("chat_http_request_duration_seconds", "Duration of the HTTP requests by route.", histogramKind, []string{"method", "route", "status"}, DefaultBuckets)
+
+	return r
+}
+
+// registry is Registry implementation
+type registry struct {
+	// families is not modified after NewRegistry, every family has its own lock
+	families []*family
+
+	// connectionsByUser counts the connections of every connected user, the
+	// users are only exposed as their number so that no user ID leaks out
+	usersMu           sync.Mutex
+	connectionsByUser map[int]int
+
+	activeConnections *family
+	connectedUsers    *family
+	received          *family
+	delivered         *family
+	dropped           *family
+	queueDepth        *family
+	writeErrors       *family
+	writeDuration     *family
+	upgradeFailures   *family
+	requestDuration   *family
+}
+
+func (r *registry) register(name string, help string, kind string, labels []string, buckets []float64) *family {
+	f := newFamily(name, help, kind, labels, buckets)
+	r.families = append(r.families, f)
+
+	return f
+}
+
+// ConnectionOpened implementation
+func (r *registry) ConnectionOpened(userID int) {
+	r.activeConnections.add(1)
+
+	r.usersMu.Lock()
+	defer r.usersMu.Unlock()
+
+	if r.connectionsByUser[userID]++; r.connectionsByUser[userID] == 1 {
+		r.connectedUsers.add(1)
+	}
+}
+
+// ConnectionClosed implementation
+func (r *registry) ConnectionClosed(userID int) {
+	r.activeConnections.add(-1)
+
+	r.usersMu.Lock()
+	defer r.usersMu.Unlock()
+
+	if r.connectionsByUser[userID]--; r.connectionsByUser[userID] <= 0 {
+		delete(r.connectionsByUser, userID)
+		r.connectedUsers.add(-1)
+	}
+}
+
+// MessageReceived implementation
+func (r *registry) MessageReceived(messageType model.MessageType) {
+	r.received.add(1, messageType.String())
+}
+
+// MessageDelivered implementation
+func (r *registry) MessageDelivered(messageType model.MessageType) {
+	r.delivered.add(1, messageType.String())
+}
+
+// MessageDropped implementation
+func (r *registry) MessageDropped() {
+	r.dropped.add(1)
+}
+
+// QueueDepthChanged implementation
+func (r *registry) QueueDepthChanged(delta int) {
+	r.queueDepth.add(float64(delta))
+}
+
+// MessageWritten implementation
+func (r *registry) MessageWritten(latency time.Duration, err error) {
+	r.writeDuration.observe(latency.Seconds())
+	if err != nil {
+		r.writeErrors.add(1)
+	}
+}
+
+// UpgradeFailed implementation
+func (r *registry) UpgradeFailed() {
+	r.upgradeFailures.add(1)
+}
+
+// RequestHandled implementation
+func (r *registry) RequestHandled(method string, route string, status int, duration time.Duration) {
+	r.requestDuration.observe(duration.Seconds(), method, route, strconv.Itoa(status))
+}
+
+// Expose implementation
+func (r *registry) Expose(w io.Writer) error {
+	for _, f := range r.families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gifff/chat-server/model"
+)
+
+func expose(t *testing.T, r Registry) string {
+	t.Helper()
+
+	var b strings.Builder
+	if err := r.Expose(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func assertLines(t *testing.T, exposition string, want ...string) {
+	t.Helper()
+
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(exposition, "\n") {
+		lines[line] = true
+	}
+	for _, line := range want {
+		if !lines[line] {
+			t.Errorf("missing line %q in:\n%s", line, exposition)
+		}
+	}
+}
+
+func TestRegistryExposesEveryMetricBeforeAnyRecord(t *testing.T) {
+	out := expose(t, NewRegistry())
+
+	assertLines(t, out,
+		"# HELP chat_connections_active Websocket connections currently registered.",
+		"# TYPE chat_connections_active gauge",
+		"chat_connections_active 0",
+		"chat_users_connected 0",
+		"# TYPE chat_messages_received_total counter",
+		"# TYPE chat_messages_delivered_total counter",
+		"chat_messages_dropped_total 0",
+		"chat_dispatch_queue_depth 0",
+		"chat_write_errors_total 0",
+		"# TYPE chat_write_duration_seconds histogram",
+		`chat_write_duration_seconds_bucket{le="+Inf"} 0`,
+		"chat_websocket_upgrade_failures_total 0",
+		"# TYPE chat_http_request_duration_seconds histogram",
+	)
+}
+
+func TestRegistryConnections(t *testing.T) {
+	r := NewRegistry()
+	r.ConnectionOpened(1)
+	r.ConnectionOpened(1)
+	r.ConnectionOpened(2)
+	r.ConnectionClosed(2)
+
+	out := expose(t, r)
+	assertLines(t, out,
+		"chat_connections_active 2",
+		"chat_users_connected 1",
+	)
+	if strings.Contains(out, "user_id=") {
+		t.Errorf("the connections are exposed by user:\n%s", out)
+	}
+}
+
+func TestRegistryMessages(t *testing.T) {
+	r := NewRegistry()
+	r.MessageReceived(model.TextMessage)
+	r.MessageReceived(model.TextMessage)
+	r.MessageReceived(model.AckMessage)
+	r.MessageDelivered(model.PresenceMessage)
+	r.MessageDropped()
+	r.QueueDepthChanged(3)
+	r.QueueDepthChanged(-1)
+
+	assertLines(t, expose(t, r),
+		`chat_messages_received_total{type="ack"} 1`,
+		`chat_messages_received_total{type="text"} 2`,
+		`chat_messages_delivered_total{type="presence"} 1`,
+		"chat_messages_dropped_total 1",
+		"chat_dispatch_queue_depth 2",
+	)
+}
+
+func TestRegistryConcurrentRecords(t *testing.T) {
+	const goroutines, records = 8, 500
+
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(userID int) {
+			defer wg.Done()
+
+			for j := 0; j < records; j++ {
+				r.ConnectionOpened(userID)
+				r.QueueDepthChanged(1)
+				r.MessageDelivered(model.TextMessage)
+				r.MessageWritten(time.Millisecond, nil)
+				r.QueueDepthChanged(-1)
+				r.ConnectionClosed(userID)
+			}
+		}(i)
+	}
+	// scraping meanwhile sees consistent families
+	for i := 0; i < 10; i++ {
+		expose(t, r)
+	}
+	wg.Wait()
+
+	assertLines(t, expose(t, r),
+		"chat_connections_active 0",
+		"chat_users_connected 0",
+		"chat_dispatch_queue_depth 0",
+		`chat_messages_delivered_total{type="text"} 4000`,
+		"chat_write_duration_seconds_count 4000",
+	)
+}
+
+func TestRegistryHistograms(t *testing.T) {
+	r := NewRegistry()
+	r.MessageWritten(2*time.Millisecond, nil)
+	r.MessageWritten(2*time.Second, errors.New("broken pipe"))
+	r.RequestHandled("GET", "/rooms/:room_id", 404, 30*time.Millisecond)
+
+	assertLines(t, expose(t, r),
+		"chat_write_errors_total 1",
+		`chat_write_duration_seconds_bucket{le="0.001"} 0`,
+		`chat_write_duration_seconds_bucket{le="0.0025"} 1`,
+		`chat_write_duration_seconds_bucket{le="1"} 1`,
+		`chat_write_duration_seconds_bucket{le="2.5"} 2`,
+		`chat_write_duration_seconds_bucket{le="+Inf"} 2`,
+		"chat_write_duration_seconds_sum 2.002",
+		"chat_write_duration_seconds_count 2",
+		`chat_http_request_duration_seconds_bucket{method="GET",route="/rooms/:room_id",status="404",le="0.05"} 1`,
+		`chat_http_request_duration_seconds_count{method="GET",route="/rooms/:room_id",status="404"} 1`,
+	)
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if got, want := escapeLabelValue("a\"b\\c\nd"), `a\"b\\c\nd`; got != want {
+		t.Errorf("escapeLabelValue() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package model
+
+// UserConnections data model of the connections of a connected user
+type UserConnections struct {
+	UserID      int `json:"user_id"`
+	Connections int `json:"connections"`
+}
+
+// ConnectionStatus data model of the delivery to a listening connection
+type ConnectionStatus struct {
+	ID          int    `json:"id"`
+	RoomID      int    `json:"room_id"`
+	Presence    bool   `json:"presence"`
+	Ack         bool   `json:"ack"`
+	Dispatched  uint64 `json:"dispatched"`
+	Written     uint64 `json:"written"`
+	WriteErrors uint64 `json:"write_errors"`
+	Dropped     uint64 `json:"dropped"`
+	Queued      int    `json:"queued"`
+	Acked       uint64 `json:"acked"`
+	Pending     int    `json:"pending"`
+	Retried     uint64 `json:"retried"`
+	Expired     uint64 `json:"expired"`
+}
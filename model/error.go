@@ -0,0 +1,7 @@
+package model
+
+// Error data model returned on failed requests
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
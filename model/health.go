@@ -0,0 +1,15 @@
+package model
+
+const (
+	// HealthOK is the status of an alive server
+	HealthOK = "ok"
+	// HealthReady is the status of a server accepting new connections
+	HealthReady = "ready"
+	// HealthDraining is the status of a server closing its connections before shutting down
+	HealthDraining = "draining"
+)
+
+// Health data model of the health and readiness checks
+type Health struct {
+	Status string `json:"status"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// LogLevels data model of the levels of the logger, the components without
+// a level of their own log at the default level
+type LogLevels struct {
+	Default    string            `json:"default"`
+	Components map[string]string `json:"components"`
+}
+
+// LogLevelUpdate data model to change the default level, when Component is
+// empty, or the level of a component. An empty Level makes the component log
+// at the default level again.
+type LogLevelUpdate struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
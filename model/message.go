@@ -1,18 +1,82 @@
 package model
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
 // User data model
 type User struct {
-	ID   int    `json:"id"`
-	Name string `json:"string"`
-	IsMe bool   `json:"is_me"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	IsMe      bool   `json:"is_me"`
 }
 
 // Message data model
 type Message struct {
-	ID      int         `json:"id"`
-	Type    MessageType `json:"type"`
-	Message string      `json:"message"`
-	User    User        `json:"user"`
+	ID        int64       `json:"id"`
+	Type      MessageType `json:"type"`
+	Message   string      `json:"message"`
+	User      User        `json:"user"`
+	RoomID    int         `json:"room_id,omitempty"`
+	ToUserID  int         `json:"to_user_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Retracted bool        `json:"retracted,omitempty"`
+	Revision  int         `json:"revision,omitempty"`
+	Status    string      `json:"status,omitempty"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+}
+
+// message has the fields of Message without its JSON methods
+type message Message
+
+// MarshalJSON encodes the ID as a string, snowflake IDs exceed the integers
+// JavaScript represents exactly
+func (m Message) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		message
+		ID int64 `json:"id,string"`
+	}{message: message(m), ID: m.ID})
+}
+
+// UnmarshalJSON accepts the ID either as a string or as a number
+func (m *Message) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*message
+		ID json.Number `json:"id"`
+	}{message: (*message)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.ID == "" {
+		return nil
+	}
+
+	id, err := aux.ID.Int64()
+	if err != nil {
+		return err
+	}
+	m.ID = id
+	return nil
+}
+
+// MessageRevision data model of a superseded body of an edited message
+type MessageRevision struct {
+	Revision  int       `json:"revision"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MessagePage data model of a message history page.
+// NextCursor is the ID to pass as the same cursor parameter to fetch the following page.
+// It is empty when there are no more messages.
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
 // MessageType enum type
@@ -25,4 +89,163 @@ const (
 	TextMessage
 	// RetractMessage message type
 	RetractMessage
+	// EditMessage message type
+	EditMessage
+	// UserUpdatedMessage message type, the event of a changed profile
+	UserUpdatedMessage
+	// PresenceMessage message type, the event of a user going online or offline
+	PresenceMessage
+	// TypingMessage message type, sent while the user is typing. It is relayed
+	// without being stored and should be hidden once it expires.
+	TypingMessage
+	// ReadMessage message type, sent by the client with the ID of the most recent
+	// message it has read and relayed as a read receipt
+	ReadMessage
+	// AckMessage message type, sent by a client listening in ack mode with the ID
+	// of every text message it received
+	AckMessage
+)
+
+// String returns the name of the message type, as used in the metrics
+func (t MessageType) String() string {
+	switch t {
+	case TextMessage:
+		return "text"
+	case RetractMessage:
+		return "retract"
+	case EditMessage:
+		return "edit"
+	case UserUpdatedMessage:
+		return "user_updated"
+	case PresenceMessage:
+		return "presence"
+	case TypingMessage:
+		return "typing"
+	case ReadMessage:
+		return "read"
+	case AckMessage:
+		return "ack"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// OnlineStatus is the status of a PresenceMessage of a user who went online
+	OnlineStatus = "online"
+	// OfflineStatus is the status of a PresenceMessage of a user who went offline
+	OfflineStatus = "offline"
 )
+
+// UserFromDomain builds the User data model of the given entity as seen by viewerID
+func UserFromDomain(user domain.User, viewerID int) User {
+	return User{
+		ID:        user.ID,
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+		IsMe:      user.ID == viewerID,
+	}
+}
+
+// MessageFromDomain builds the Message data model of the given entity written by author as seen by viewerID.
+// The body of a retracted message is left out.
+func MessageFromDomain(msg domain.Message, author domain.User, viewerID int) Message {
+	m := Message{
+		ID:        msg.ID,
+		Type:      messageTypeFromDomain(msg.Type),
+		Message:   msg.Message,
+		User:      UserFromDomain(author, viewerID),
+		RoomID:    msg.RoomID,
+		ToUserID:  msg.ToUserID,
+		Timestamp: msg.CreatedAt,
+		Revision:  msg.Revision,
+	}
+
+	if msg.IsRetracted() {
+		m.Message = ""
+		m.Retracted = true
+	}
+
+	return m
+}
+
+// RetractionFromDomain builds the RetractMessage event of the given retracted entity as seen by viewerID
+func RetractionFromDomain(msg domain.Message, author domain.User, viewerID int) Message {
+	return Message{
+		ID:        msg.ID,
+		Type:      RetractMessage,
+		User:      UserFromDomain(author, viewerID),
+		RoomID:    msg.RoomID,
+		ToUserID:  msg.ToUserID,
+		Timestamp: msg.RetractedAt,
+		Retracted: true,
+	}
+}
+
+// EditFromDomain builds the EditMessage event of the given edited entity as seen by viewerID
+func EditFromDomain(msg domain.Message, author domain.User, viewerID int) Message {
+	return Message{
+		ID:        msg.ID,
+		Type:      EditMessage,
+		Message:   msg.Message,
+		User:      UserFromDomain(author, viewerID),
+		RoomID:    msg.RoomID,
+		ToUserID:  msg.ToUserID,
+		Timestamp: msg.EditedAt,
+		Revision:  msg.Revision,
+	}
+}
+
+// UserUpdateFromDomain builds the UserUpdatedMessage event of the given updated entity as seen by viewerID
+func UserUpdateFromDomain(user domain.User, viewerID int) Message {
+	return Message{
+		Type:      UserUpdatedMessage,
+		User:      UserFromDomain(user, viewerID),
+		Timestamp: user.UpdatedAt,
+	}
+}
+
+// PresenceFromDomain builds the PresenceMessage event of the user going online or offline at the given time as seen by viewerID
+func PresenceFromDomain(user domain.User, online bool, at time.Time, viewerID int) Message {
+	status := OfflineStatus
+	if online {
+		status = OnlineStatus
+	}
+
+	return Message{
+		Type:      PresenceMessage,
+		User:      UserFromDomain(user, viewerID),
+		Timestamp: at,
+		Status:    status,
+	}
+}
+
+// TypingFromDomain builds the TypingMessage event of the given entity typed by author as seen by viewerID
+func TypingFromDomain(event domain.TypingEvent, author domain.User, viewerID int) Message {
+	return Message{
+		Type:      TypingMessage,
+		User:      UserFromDomain(author, viewerID),
+		RoomID:    event.RoomID,
+		ToUserID:  event.ToUserID,
+		Timestamp: event.CreatedAt,
+		ExpiresAt: &event.ExpiresAt,
+	}
+}
+
+// MessageRevisionFromDomain builds the MessageRevision data model of the given revision
+func MessageRevisionFromDomain(rev domain.MessageRevision) MessageRevision {
+	return MessageRevision{
+		Revision:  rev.Revision,
+		Message:   rev.Message,
+		Timestamp: rev.CreatedAt,
+	}
+}
+
+func messageTypeFromDomain(t domain.MessageType) MessageType {
+	switch t {
+	case domain.TextMessage:
+		return TextMessage
+	default:
+		return UnknownMessage
+	}
+}
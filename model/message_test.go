@@ -0,0 +1,56 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMessageIDAsString(t *testing.T) {
+	// 2^53 + 1 is the first integer a float64, and so JavaScript, rounds
+	const id = int64(1)<<53 + 1
+
+	data, err := json.Marshal(Message{ID: id, Type: TextMessage, Message: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"id":"9007199254740993"`) {
+		t.Errorf("json.Marshal = %s, want the ID as a string", data)
+	}
+	// the message and its user
+	if strings.Count(string(data), `"id"`) != 2 {
+		t.Errorf("json.Marshal = %s, want a single message ID", data)
+	}
+
+	testCases := []struct {
+		name    string
+		data    string
+		wantID  int64
+		wantErr bool
+	}{
+		{name: "string", data: `{"id":"9007199254740993","type":1}`, wantID: id},
+		{name: "number", data: `{"id":9007199254740993,"type":1}`, wantID: id},
+		{name: "missing", data: `{"type":1}`, wantID: 0},
+		{name: "fraction", data: `{"id":1.5,"type":1}`, wantErr: true},
+		{name: "not a number", data: `{"id":"abc","type":1}`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var msg Message
+			err := json.Unmarshal([]byte(tc.data), &msg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("json.Unmarshal(%s) = %+v, want an error", tc.data, msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.ID != tc.wantID || msg.Type != TextMessage {
+				t.Errorf("json.Unmarshal(%s) = %+v, want ID %d", tc.data, msg, tc.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package model
+
+import "github.com/gifff/chat-server/domain"
+
+// UnreadCount data model of the unread messages of a conversation, a room or
+// the direct messages with UserID when it is set. LastReadID is a string like
+// Message.ID.
+type UnreadCount struct {
+	RoomID     int   `json:"room_id"`
+	UserID     int   `json:"user_id,omitempty"`
+	LastReadID int64 `json:"last_read_id,string"`
+	Unread     int   `json:"unread"`
+}
+
+// Unread data model of the unread messages of every conversation of a user
+type Unread struct {
+	Total         int           `json:"total"`
+	Conversations []UnreadCount `json:"conversations"`
+}
+
+// UnreadFromDomain builds the Unread data model of the given unread counts
+func UnreadFromDomain(counts []domain.UnreadCount) Unread {
+	unread := Unread{
+		Conversations: make([]UnreadCount, len(counts)),
+	}
+	for i, c := range counts {
+		unread.Conversations[i] = UnreadCount{
+			RoomID:     c.RoomID,
+			UserID:     c.PeerID,
+			LastReadID: c.LastReadID,
+			Unread:     c.Unread,
+		}
+		unread.Total += c.Unread
+	}
+
+	return unread
+}
+
+// ReadReceiptFromDomain builds the ReadMessage event of the given marker of reader as seen by viewerID
+func ReadReceiptFromDomain(marker domain.ReadMarker, reader domain.User, viewerID int) Message {
+	return Message{
+		ID:        marker.MessageID,
+		Type:      ReadMessage,
+		User:      UserFromDomain(reader, viewerID),
+		RoomID:    marker.RoomID,
+		ToUserID:  marker.PeerID,
+		Timestamp: marker.ReadAt,
+	}
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// Room data model
+type Room struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy int       `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoomFromDomain builds the Room data model of the given entity
+func RoomFromDomain(room domain.Room) Room {
+	return Room{
+		ID:        room.ID,
+		Name:      room.Name,
+		CreatedBy: room.CreatedBy,
+		CreatedAt: room.CreatedAt,
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// logFile is an append-only file of JSON records, one record per line
+type logFile struct {
+	file *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logFile{file: f}, nil
+}
+
+// replay passes every record to apply in the order they were written. A trailing
+// partial line, which is left behind when the process dies in the middle of a write,
+// is truncated away.
+func (l *logFile) replay(apply func(line []byte) error) error {
+	reader := bufio.NewReader(l.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := l.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := apply(line); err != nil {
+			return fmt.Errorf("corrupted log %s at offset %d: %w", l.file.Name(), offset, err)
+		}
+
+		offset += int64(len(line))
+	}
+
+	_, err := l.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// append writes the record and waits for it to reach the disk
+func (l *logFile) append(record interface{}) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	return l.file.Sync()
+}
+
+func (l *logFile) close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// ErrMessageNotFound is returned when there is no message with the requested ID
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrDuplicateMessageID is returned when a message with the same ID has been stored before
+var ErrDuplicateMessageID = errors.New("duplicate message id")
+
+// ErrMessageAlreadyRetracted is returned when retracting a message twice
+var ErrMessageAlreadyRetracted = errors.New("message already retracted")
+
+// MessageRepository contract
+type MessageRepository interface {
+	// Insert stores a new message. The message ID must be assigned by the caller.
+	Insert(message domain.Message) error
+	// Get returns the message with the given ID or ErrMessageNotFound
+	Get(id int64) (domain.Message, error)
+	// Retract marks the message as retracted at the given time and returns the updated message
+	Retract(id int64, at time.Time) (domain.Message, error)
+	// Edit replaces the body of the message, keeping the previous body as a revision,
+	// and returns the updated message
+	Edit(id int64, message string, at time.Time) (domain.Message, error)
+	// Revisions returns the superseded revisions of the message ordered from the oldest
+	Revisions(id int64) ([]domain.MessageRevision, error)
+	// List returns the messages matching the query ordered by ascending ID
+	List(query MessageQuery) ([]domain.Message, error)
+	// CountAfter returns the number of messages of the conversation selected by the
+	// query with an ID greater than query.AfterID, leaving out the retracted ones and
+	// the ones written by excludedUserID. The other bounds of the query are ignored.
+	CountAfter(query MessageQuery, excludedUserID int) (int, error)
+	// Peers returns the users the user has exchanged direct messages with in ascending order
+	Peers(userID int) ([]int, error)
+	// LastID returns the highest stored message ID, or 0 when the repository is empty
+	LastID() int64
+	// Close releases the underlying resources
+	Close() error
+}
+
+// MessageQuery selects a page of messages of a room, or of the direct messages between
+// two users when Between is set. WithDirectOf mixes every direct message sent or received
+// by that user into the room messages. BeforeID and AfterID are exclusive bounds and zero
+// means unbounded. The page holds the newest messages within the bounds, or the oldest
+// ones when Forward is set.
+type MessageQuery struct {
+	RoomID       int
+	Between      [2]int
+	WithDirectOf int
+	BeforeID     int64
+	AfterID      int64
+	Limit        int
+	Forward      bool
+}
+
+// IsDirect tells whether the query selects direct messages
+func (q MessageQuery) IsDirect() bool {
+	return q.Between != [2]int{}
+}
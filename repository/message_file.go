@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+const (
+	// opInsert records a new message. It is the zero value so the records
+	// written before operations were introduced are read as inserts.
+	opInsert = ""
+	// opRetract records the retraction of an inserted message
+	opRetract = "retract"
+	// opEdit records a new body of an inserted message
+	opEdit = "edit"
+)
+
+// messageRecord is the on-disk representation of an operation on a message.
+// Every record is written as a single JSON line.
+type messageRecord struct {
+	Op          string             `json:"op,omitempty"`
+	ID          int64              `json:"id"`
+	Type        domain.MessageType `json:"type,omitempty"`
+	Message     string             `json:"message,omitempty"`
+	UserID      int                `json:"user_id,omitempty"`
+	RoomID      int                `json:"room_id,omitempty"`
+	ToUserID    int                `json:"to_user_id,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	RetractedAt *time.Time         `json:"retracted_at,omitempty"`
+	EditedAt    *time.Time         `json:"edited_at,omitempty"`
+}
+
+// OpenFileMessageRepository opens (or creates) an append-only message log at path
+// and loads the stored messages into memory
+func OpenFileMessageRepository(path string) (MessageRepository, error) {
+	log, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &fileMessageRepository{
+		inMemoryMessageRepository: newInMemoryMessageRepository(),
+		log:                       log,
+	}
+
+	err = log.replay(func(line []byte) error {
+		var record messageRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		return r.apply(record)
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// fileMessageRepository serves reads from memory and appends every write to the log file
+type fileMessageRepository struct {
+	*inMemoryMessageRepository
+	log *logFile
+}
+
+// apply replays a record on the in-memory state
+func (r *fileMessageRepository) apply(record messageRecord) error {
+	switch record.Op {
+	case opInsert:
+		return r.insert(record.toDomain())
+	case opRetract:
+		if record.RetractedAt == nil {
+			return fmt.Errorf("retract record of message %d without time", record.ID)
+		}
+		if err := r.checkRetractable(record.ID); err != nil {
+			return err
+		}
+		r.retract(record.ID, *record.RetractedAt)
+		return nil
+	case opEdit:
+		if record.EditedAt == nil {
+			return fmt.Errorf("edit record of message %d without time", record.ID)
+		}
+		if err := r.checkRetractable(record.ID); err != nil {
+			return err
+		}
+		r.edit(record.ID, record.Message, *record.EditedAt)
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q", record.Op)
+	}
+}
+
+// Insert implementation
+func (r *fileMessageRepository) Insert(message domain.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.index[message.ID]; ok {
+		return ErrDuplicateMessageID
+	}
+
+	if err := r.log.append(newMessageRecord(message)); err != nil {
+		return err
+	}
+
+	return r.insert(message)
+}
+
+// Retract implementation
+func (r *fileMessageRepository) Retract(id int64, at time.Time) (domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkRetractable(id); err != nil {
+		return domain.Message{}, err
+	}
+
+	err := r.log.append(messageRecord{
+		Op:          opRetract,
+		ID:          id,
+		RetractedAt: &at,
+	})
+	if err != nil {
+		return domain.Message{}, err
+	}
+
+	return r.retract(id, at), nil
+}
+
+// Edit implementation
+func (r *fileMessageRepository) Edit(id int64, message string, at time.Time) (domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkRetractable(id); err != nil {
+		return domain.Message{}, err
+	}
+
+	err := r.log.append(messageRecord{
+		Op:       opEdit,
+		ID:       id,
+		Message:  message,
+		EditedAt: &at,
+	})
+	if err != nil {
+		return domain.Message{}, err
+	}
+
+	return r.edit(id, message, at), nil
+}
+
+// Close implementation
+func (r *fileMessageRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.log.close()
+}
+
+func newMessageRecord(message domain.Message) messageRecord {
+	return messageRecord{
+		Op:        opInsert,
+		ID:        message.ID,
+		Type:      message.Type,
+		Message:   message.Message,
+		UserID:    message.UserID,
+		RoomID:    message.RoomID,
+		ToUserID:  message.ToUserID,
+		CreatedAt: message.CreatedAt,
+	}
+}
+
+func (m messageRecord) toDomain() domain.Message {
+	return domain.Message{
+		ID:        m.ID,
+		Type:      m.Type,
+		Message:   m.Message,
+		UserID:    m.UserID,
+		RoomID:    m.RoomID,
+		ToUserID:  m.ToUserID,
+		CreatedAt: m.CreatedAt,
+	}
+}
@@ -0,0 +1,213 @@
+package repository_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+func TestFileMessageRepositorySurvivesReopen(t *testing.T) {
+	path := filepath.Join(tempDir(t), "messages.jsonl")
+
+	r, err := repository.OpenFileMessageRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2020, 5, 24, 10, 0, 0, 0, time.UTC)
+	messages := []domain.Message{
+		{ID: 1, Type: domain.TextMessage, Message: "hello", UserID: 100, CreatedAt: createdAt},
+		{ID: 2, Type: domain.TextMessage, Message: "hello2", UserID: 200, CreatedAt: createdAt.Add(time.Second)},
+	}
+	for _, msg := range messages {
+		if err := r.Insert(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.Insert(messages[0]); err != repository.ErrDuplicateMessageID {
+		t.Errorf("duplicate insert: got err = %v, want %v", err, repository.ErrDuplicateMessageID)
+	}
+
+	editedAt := createdAt.Add(30 * time.Second)
+	if _, err := r.Edit(1, "hello, edited", editedAt); err != nil {
+		t.Fatal(err)
+	}
+	messages[0].Message = "hello, edited"
+	messages[0].Revision = 1
+	messages[0].EditedAt = editedAt
+
+	retractedAt := createdAt.Add(time.Minute)
+	if _, err := r.Retract(2, retractedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Retract(2, retractedAt); err != repository.ErrMessageAlreadyRetracted {
+		t.Errorf("second retract: got err = %v, want %v", err, repository.ErrMessageAlreadyRetracted)
+	}
+	if _, err := r.Edit(2, "too late", retractedAt); err != repository.ErrMessageAlreadyRetracted {
+		t.Errorf("edit of retracted message: got err = %v, want %v", err, repository.ErrMessageAlreadyRetracted)
+	}
+	messages[1].RetractedAt = retractedAt
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = repository.OpenFileMessageRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if got, want := r.LastID(), int64(2); got != want {
+		t.Errorf("LastID() = %d, want %d", got, want)
+	}
+
+	for _, want := range messages {
+		got, err := r.Get(want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("message %d: CreatedAt = %s, want %s", want.ID, got.CreatedAt, want.CreatedAt)
+		}
+		if !got.EditedAt.Equal(want.EditedAt) {
+			t.Errorf("message %d: EditedAt = %s, want %s", want.ID, got.EditedAt, want.EditedAt)
+		}
+		if !got.RetractedAt.Equal(want.RetractedAt) {
+			t.Errorf("message %d: RetractedAt = %s, want %s", want.ID, got.RetractedAt, want.RetractedAt)
+		}
+		got.CreatedAt, got.EditedAt, got.RetractedAt = want.CreatedAt, want.EditedAt, want.RetractedAt
+		if got != want {
+			t.Errorf("message %d: got = %+v, want %+v", want.ID, got, want)
+		}
+	}
+
+	revisions, err := r.Revisions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Revision != 0 || revisions[0].Message != "hello" || !revisions[0].CreatedAt.Equal(createdAt) {
+		t.Errorf("Revisions(1) = %+v, want the original revision", revisions)
+	}
+
+	if _, err := r.Get(3); err != repository.ErrMessageNotFound {
+		t.Errorf("Get(3): got err = %v, want %v", err, repository.ErrMessageNotFound)
+	}
+}
+
+func TestFileMessageRepositoryTruncatesPartialRecord(t *testing.T) {
+	path := filepath.Join(tempDir(t), "messages.jsonl")
+
+	log := `{"id":1,"type":1,"message":"hello","user_id":100,"created_at":"2020-05-24T10:00:00Z"}` + "\n" +
+		`{"id":2,"type":1,"mess`
+	if err := ioutil.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := repository.OpenFileMessageRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.LastID(), int64(1); got != want {
+		t.Errorf("LastID() = %d, want %d", got, want)
+	}
+
+	if err := r.Insert(domain.Message{ID: 2, Type: domain.TextMessage, Message: "hello2", UserID: 200}); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	r, err = repository.OpenFileMessageRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	msg, err := r.Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := msg.Message, "hello2"; got != want {
+		t.Errorf("message 2: Message = %q, want %q", got, want)
+	}
+}
+
+func TestFileMessageRepositoryListsDirectMessages(t *testing.T) {
+	path := filepath.Join(tempDir(t), "messages.jsonl")
+
+	r, err := repository.OpenFileMessageRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2020, 5, 24, 10, 0, 0, 0, time.UTC)
+	messages := []domain.Message{
+		{ID: 1, Type: domain.TextMessage, Message: "room", UserID: 100, CreatedAt: createdAt},
+		{ID: 2, Type: domain.TextMessage, Message: "to 200", UserID: 100, ToUserID: 200, CreatedAt: createdAt},
+		{ID: 3, Type: domain.TextMessage, Message: "to 100", UserID: 300, ToUserID: 100, CreatedAt: createdAt},
+		{ID: 4, Type: domain.TextMessage, Message: "to 300", UserID: 200, ToUserID: 300, CreatedAt: createdAt},
+		{ID: 5, Type: domain.TextMessage, Message: "room again", UserID: 200, CreatedAt: createdAt},
+	}
+	for _, msg := range messages {
+		if err := r.Insert(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = repository.OpenFileMessageRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	testCases := []struct {
+		name  string
+		query repository.MessageQuery
+		want  []int64
+	}{
+		{name: "room", query: repository.MessageQuery{}, want: []int64{1, 5}},
+		{name: "conversation", query: repository.MessageQuery{Between: [2]int{200, 100}}, want: []int64{2}},
+		{name: "room with direct messages", query: repository.MessageQuery{WithDirectOf: 100}, want: []int64{1, 2, 3, 5}},
+		{name: "newest page", query: repository.MessageQuery{WithDirectOf: 100, Limit: 2}, want: []int64{3, 5}},
+		{name: "oldest page", query: repository.MessageQuery{WithDirectOf: 100, AfterID: 1, Limit: 2, Forward: true}, want: []int64{2, 3}},
+	}
+
+	for _, tc := range testCases {
+		got, err := r.List(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]int64, len(got))
+		for i, msg := range got {
+			ids[i] = msg.ID
+		}
+		if !reflect.DeepEqual(ids, tc.want) {
+			t.Errorf("%s: listed %v, want %v", tc.name, ids, tc.want)
+		}
+	}
+}
+
+// tempDir returns a directory removed once the test ends
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "chat-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
@@ -0,0 +1,344 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// NewInMemoryMessageRepository returns MessageRepository which keeps the messages in memory only
+func NewInMemoryMessageRepository() MessageRepository {
+	return newInMemoryMessageRepository()
+}
+
+func newInMemoryMessageRepository() *inMemoryMessageRepository {
+	return &inMemoryMessageRepository{
+		timelines: make(map[timelineKey]*timeline),
+		index:     make(map[int64]timelineKey),
+		revisions: make(map[int64][]domain.MessageRevision),
+	}
+}
+
+// timelineKey identifies the conversation a message belongs to, either a room
+// or the direct messages between two users stored in ascending order
+type timelineKey struct {
+	roomID int
+	users  [2]int
+}
+
+func timelineOf(message domain.Message) timelineKey {
+	if message.IsDirect() {
+		return directTimeline(message.UserID, message.ToUserID)
+	}
+
+	return timelineKey{roomID: message.RoomID}
+}
+
+func timelineOfQuery(query MessageQuery) timelineKey {
+	if query.IsDirect() {
+		return directTimeline(query.Between[0], query.Between[1])
+	}
+
+	return timelineKey{roomID: query.RoomID}
+}
+
+func directTimeline(userID int, peerID int) timelineKey {
+	if peerID < userID {
+		userID, peerID = peerID, userID
+	}
+
+	return timelineKey{users: [2]int{userID, peerID}}
+}
+
+// timeline holds the messages of a conversation ordered by ID
+type timeline struct {
+	messages []domain.Message
+}
+
+func (t *timeline) insert(message domain.Message) {
+	n := len(t.messages)
+	if n == 0 || t.messages[n-1].ID < message.ID {
+		t.messages = append(t.messages, message)
+		return
+	}
+
+	// out of order insertion, keep the slice sorted
+	i := t.search(message.ID)
+	t.messages = append(t.messages, domain.Message{})
+	copy(t.messages[i+1:], t.messages[i:])
+	t.messages[i] = message
+}
+
+// search returns the position of the first message with ID greater than or equal to id
+func (t *timeline) search(id int64) int {
+	return sort.Search(len(t.messages), func(i int) bool {
+		return t.messages[i].ID >= id
+	})
+}
+
+// inMemoryMessageRepository keeps messages in per conversation timelines along with
+// an index of the timeline of every message ID and the superseded revisions of the
+// edited messages
+type inMemoryMessageRepository struct {
+	mu        sync.RWMutex
+	timelines map[timelineKey]*timeline
+	index     map[int64]timelineKey
+	revisions map[int64][]domain.MessageRevision
+	lastID    int64
+}
+
+// Insert implementation
+func (r *inMemoryMessageRepository) Insert(message domain.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.insert(message)
+}
+
+func (r *inMemoryMessageRepository) insert(message domain.Message) error {
+	if _, ok := r.index[message.ID]; ok {
+		return ErrDuplicateMessageID
+	}
+
+	key := timelineOf(message)
+	t, ok := r.timelines[key]
+	if !ok {
+		t = &timeline{}
+		r.timelines[key] = t
+	}
+
+	t.insert(message)
+	r.index[message.ID] = key
+	if message.ID > r.lastID {
+		r.lastID = message.ID
+	}
+
+	return nil
+}
+
+// locate returns a pointer to the stored message. The pointer must not be kept
+// after releasing the lock since insertions may move the messages around.
+func (r *inMemoryMessageRepository) locate(id int64) (*domain.Message, bool) {
+	key, ok := r.index[id]
+	if !ok {
+		return nil, false
+	}
+
+	t := r.timelines[key]
+	return &t.messages[t.search(id)], true
+}
+
+// Get implementation
+func (r *inMemoryMessageRepository) Get(id int64) (domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	msg, ok := r.locate(id)
+	if !ok {
+		return domain.Message{}, ErrMessageNotFound
+	}
+
+	return *msg, nil
+}
+
+// Retract implementation
+func (r *inMemoryMessageRepository) Retract(id int64, at time.Time) (domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkRetractable(id); err != nil {
+		return domain.Message{}, err
+	}
+
+	return r.retract(id, at), nil
+}
+
+// Edit implementation
+func (r *inMemoryMessageRepository) Edit(id int64, message string, at time.Time) (domain.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkRetractable(id); err != nil {
+		return domain.Message{}, err
+	}
+
+	return r.edit(id, message, at), nil
+}
+
+func (r *inMemoryMessageRepository) edit(id int64, message string, at time.Time) domain.Message {
+	msg, _ := r.locate(id)
+	r.revisions[id] = append(r.revisions[id], msg.CurrentRevision())
+	msg.Message = message
+	msg.Revision++
+	msg.EditedAt = at
+
+	return *msg
+}
+
+// Revisions implementation
+func (r *inMemoryMessageRepository) Revisions(id int64) ([]domain.MessageRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.index[id]; !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	revisions := make([]domain.MessageRevision, len(r.revisions[id]))
+	copy(revisions, r.revisions[id])
+
+	return revisions, nil
+}
+
+// checkRetractable tells whether the message exists and has not been retracted,
+// which is the precondition of both edit and retract
+func (r *inMemoryMessageRepository) checkRetractable(id int64) error {
+	msg, ok := r.locate(id)
+	if !ok {
+		return ErrMessageNotFound
+	}
+	if msg.IsRetracted() {
+		return ErrMessageAlreadyRetracted
+	}
+
+	return nil
+}
+
+func (r *inMemoryMessageRepository) retract(id int64, at time.Time) domain.Message {
+	msg, _ := r.locate(id)
+	msg.RetractedAt = at
+
+	return *msg
+}
+
+// List implementation
+func (r *inMemoryMessageRepository) List(query MessageQuery) ([]domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	timelines := r.timelinesOf(query)
+
+	messages := []domain.Message{}
+	for _, t := range timelines {
+		// the page can only hold the first Limit messages of each timeline
+		messages = append(messages, t.page(query)...)
+	}
+
+	if len(timelines) < 2 {
+		return messages, nil
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+	if query.Limit > 0 && len(messages) > query.Limit {
+		if query.Forward {
+			messages = messages[:query.Limit]
+		} else {
+			messages = messages[len(messages)-query.Limit:]
+		}
+	}
+
+	return messages, nil
+}
+
+// timelinesOf returns the existing timelines selected by the query
+func (r *inMemoryMessageRepository) timelinesOf(query MessageQuery) []*timeline {
+	var timelines []*timeline
+	if t, ok := r.timelines[timelineOfQuery(query)]; ok {
+		timelines = append(timelines, t)
+	}
+
+	if query.WithDirectOf == 0 || query.IsDirect() {
+		return timelines
+	}
+
+	for key, t := range r.timelines {
+		if key.users[0] == query.WithDirectOf || key.users[1] == query.WithDirectOf {
+			timelines = append(timelines, t)
+		}
+	}
+
+	return timelines
+}
+
+// page returns a copy of the messages of the timeline selected by the query
+func (t *timeline) page(query MessageQuery) []domain.Message {
+	lo, hi := 0, len(t.messages)
+	if query.AfterID > 0 {
+		lo = t.search(query.AfterID + 1)
+	}
+	if query.BeforeID > 0 {
+		hi = t.search(query.BeforeID)
+	}
+	if lo >= hi {
+		return nil
+	}
+
+	if query.Limit > 0 && hi-lo > query.Limit {
+		if query.Forward {
+			hi = lo + query.Limit
+		} else {
+			lo = hi - query.Limit
+		}
+	}
+
+	messages := make([]domain.Message, hi-lo)
+	copy(messages, t.messages[lo:hi])
+
+	return messages
+}
+
+// CountAfter implementation
+func (r *inMemoryMessageRepository) CountAfter(query MessageQuery, excludedUserID int) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.timelines[timelineOfQuery(query)]
+	if !ok {
+		return 0, nil
+	}
+
+	n := 0
+	for _, message := range t.messages[t.search(query.AfterID+1):] {
+		if message.UserID != excludedUserID && !message.IsRetracted() {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Peers implementation
+func (r *inMemoryMessageRepository) Peers(userID int) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	peers := []int{}
+	for key := range r.timelines {
+		switch userID {
+		case key.users[0]:
+			peers = append(peers, key.users[1])
+		case key.users[1]:
+			peers = append(peers, key.users[0])
+		}
+	}
+	sort.Ints(peers)
+
+	return peers, nil
+}
+
+// LastID implementation
+func (r *inMemoryMessageRepository) LastID() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastID
+}
+
+// Close implementation
+func (r *inMemoryMessageRepository) Close() error {
+	return nil
+}
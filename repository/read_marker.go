@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"github.com/gifff/chat-server/domain"
+)
+
+// ReadMarkerRepository contract
+type ReadMarkerRepository interface {
+	// Advance stores the marker unless the user has already read up to a message
+	// at least as recent in the same conversation, and tells whether it did
+	Advance(marker domain.ReadMarker) (bool, error)
+	// List returns the read markers of the user
+	List(userID int) ([]domain.ReadMarker, error)
+	// Close releases the underlying resources
+	Close() error
+}
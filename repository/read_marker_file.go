@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// readMarkerRecord is the on-disk representation of an advanced read marker.
+// Every record is written as a single JSON line.
+type readMarkerRecord struct {
+	UserID    int       `json:"user_id"`
+	RoomID    int       `json:"room_id,omitempty"`
+	PeerID    int       `json:"peer_id,omitempty"`
+	MessageID int64     `json:"message_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+// OpenFileReadMarkerRepository opens (or creates) an append-only read marker log
+// at path and loads the stored markers into memory
+func OpenFileReadMarkerRepository(path string) (ReadMarkerRepository, error) {
+	log, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &fileReadMarkerRepository{
+		inMemoryReadMarkerRepository: newInMemoryReadMarkerRepository(),
+		log:                          log,
+	}
+
+	err = log.replay(func(line []byte) error {
+		var record readMarkerRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		r.advance(record.toDomain())
+		return nil
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// fileReadMarkerRepository serves reads from memory and appends every write to the log file
+type fileReadMarkerRepository struct {
+	*inMemoryReadMarkerRepository
+	log *logFile
+}
+
+// Advance implementation
+func (r *fileReadMarkerRepository) Advance(marker domain.ReadMarker) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isAhead(marker) {
+		return false, nil
+	}
+
+	if err := r.log.append(newReadMarkerRecord(marker)); err != nil {
+		return false, err
+	}
+
+	r.advance(marker)
+	return true, nil
+}
+
+// Close implementation
+func (r *fileReadMarkerRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.log.close()
+}
+
+func newReadMarkerRecord(marker domain.ReadMarker) readMarkerRecord {
+	return readMarkerRecord{
+		UserID:    marker.UserID,
+		RoomID:    marker.RoomID,
+		PeerID:    marker.PeerID,
+		MessageID: marker.MessageID,
+		ReadAt:    marker.ReadAt,
+	}
+}
+
+func (m readMarkerRecord) toDomain() domain.ReadMarker {
+	return domain.ReadMarker{
+		UserID:    m.UserID,
+		RoomID:    m.RoomID,
+		PeerID:    m.PeerID,
+		MessageID: m.MessageID,
+		ReadAt:    m.ReadAt,
+	}
+}
@@ -0,0 +1,71 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+func TestFileReadMarkerRepositoryOnlyAdvances(t *testing.T) {
+	path := filepath.Join(tempDir(t), "read_markers.jsonl")
+
+	r, err := repository.OpenFileReadMarkerRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readAt := time.Date(2020, 5, 24, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		marker       domain.ReadMarker
+		wantAdvanced bool
+	}{
+		{marker: domain.ReadMarker{UserID: 100, MessageID: 5, ReadAt: readAt}, wantAdvanced: true},
+		{marker: domain.ReadMarker{UserID: 100, MessageID: 3, ReadAt: readAt}, wantAdvanced: false},
+		{marker: domain.ReadMarker{UserID: 100, MessageID: 5, ReadAt: readAt}, wantAdvanced: false},
+		{marker: domain.ReadMarker{UserID: 100, RoomID: 1, MessageID: 2, ReadAt: readAt}, wantAdvanced: true},
+		{marker: domain.ReadMarker{UserID: 100, PeerID: 200, MessageID: 4, ReadAt: readAt}, wantAdvanced: true},
+		{marker: domain.ReadMarker{UserID: 200, PeerID: 100, MessageID: 1, ReadAt: readAt}, wantAdvanced: true},
+		{marker: domain.ReadMarker{UserID: 100, MessageID: 8, ReadAt: readAt}, wantAdvanced: true},
+	}
+
+	for i, tc := range testCases {
+		advanced, err := r.Advance(tc.marker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if advanced != tc.wantAdvanced {
+			t.Errorf("marker %d: advanced = %t, want %t", i, advanced, tc.wantAdvanced)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = repository.OpenFileReadMarkerRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	markers, err := r.List(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(markers, func(i, j int) bool {
+		return markers[i].MessageID < markers[j].MessageID
+	})
+
+	want := []int64{2, 4, 8}
+	if len(markers) != len(want) {
+		t.Fatalf("listed %+v, want markers of messages %v", markers, want)
+	}
+	for i, marker := range markers {
+		if marker.MessageID != want[i] || !marker.ReadAt.Equal(readAt) {
+			t.Errorf("marker %d = %+v, want message %d read at %v", i, marker, want[i], readAt)
+		}
+	}
+}
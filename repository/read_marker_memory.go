@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// NewInMemoryReadMarkerRepository returns ReadMarkerRepository which keeps the markers in memory only
+func NewInMemoryReadMarkerRepository() ReadMarkerRepository {
+	return newInMemoryReadMarkerRepository()
+}
+
+func newInMemoryReadMarkerRepository() *inMemoryReadMarkerRepository {
+	return &inMemoryReadMarkerRepository{
+		markers: make(map[int]map[conversationKey]domain.ReadMarker),
+	}
+}
+
+// conversationKey identifies the conversation of a read marker from the point of view of its user
+type conversationKey struct {
+	roomID int
+	peerID int
+}
+
+// inMemoryReadMarkerRepository keeps the markers of every user by conversation
+type inMemoryReadMarkerRepository struct {
+	mu      sync.RWMutex
+	markers map[int]map[conversationKey]domain.ReadMarker
+}
+
+// Advance implementation
+func (r *inMemoryReadMarkerRepository) Advance(marker domain.ReadMarker) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isAhead(marker) {
+		return false, nil
+	}
+
+	r.advance(marker)
+	return true, nil
+}
+
+func (r *inMemoryReadMarkerRepository) isAhead(marker domain.ReadMarker) bool {
+	current, ok := r.markers[marker.UserID][conversationKey{marker.RoomID, marker.PeerID}]
+	return !ok || current.MessageID < marker.MessageID
+}
+
+func (r *inMemoryReadMarkerRepository) advance(marker domain.ReadMarker) {
+	markers, ok := r.markers[marker.UserID]
+	if !ok {
+		markers = make(map[conversationKey]domain.ReadMarker)
+		r.markers[marker.UserID] = markers
+	}
+
+	markers[conversationKey{marker.RoomID, marker.PeerID}] = marker
+}
+
+// List implementation
+func (r *inMemoryReadMarkerRepository) List(userID int) ([]domain.ReadMarker, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	markers := make([]domain.ReadMarker, 0, len(r.markers[userID]))
+	for _, marker := range r.markers[userID] {
+		markers = append(markers, marker)
+	}
+
+	return markers, nil
+}
+
+// Close implementation
+func (r *inMemoryReadMarkerRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// ErrRoomNotFound is returned when there is no room with the requested ID
+var ErrRoomNotFound = errors.New("room not found")
+
+// ErrDuplicateRoomID is returned when a room with the same ID has been stored before
+var ErrDuplicateRoomID = errors.New("duplicate room id")
+
+// RoomRepository contract
+type RoomRepository interface {
+	// Insert stores a new room. The room ID must be assigned by the caller.
+	Insert(room domain.Room) error
+	// Get returns the room with the given ID or ErrRoomNotFound
+	Get(id int) (domain.Room, error)
+	// List returns every room ordered by ascending ID
+	List() ([]domain.Room, error)
+	// LastID returns the highest stored room ID, or 0 when the repository is empty
+	LastID() int
+	// AddMember makes the user a member of the room. Adding a member twice is a no-op.
+	AddMember(roomID int, userID int) error
+	// RemoveMember removes the user from the room. Removing a non member is a no-op.
+	RemoveMember(roomID int, userID int) error
+	// IsMember tells whether the user is a member of the room
+	IsMember(roomID int, userID int) bool
+	// Members returns the IDs of the members of the room in ascending order or ErrRoomNotFound
+	Members(roomID int) ([]int, error)
+	// Close releases the underlying resources
+	Close() error
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+const (
+	// opCreateRoom records a new room
+	opCreateRoom = ""
+	// opJoinRoom records a user becoming a member of a room
+	opJoinRoom = "join"
+	// opLeaveRoom records a user leaving a room
+	opLeaveRoom = "leave"
+)
+
+// roomRecord is the on-disk representation of an operation on a room.
+// Every record is written as a single JSON line.
+type roomRecord struct {
+	Op        string     `json:"op,omitempty"`
+	ID        int        `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	CreatedBy int        `json:"created_by,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UserID    int        `json:"user_id,omitempty"`
+}
+
+// OpenFileRoomRepository opens (or creates) an append-only room log at path
+// and loads the stored rooms and memberships into memory
+func OpenFileRoomRepository(path string) (RoomRepository, error) {
+	log, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &fileRoomRepository{
+		inMemoryRoomRepository: newInMemoryRoomRepository(),
+		log:                    log,
+	}
+
+	err = log.replay(func(line []byte) error {
+		var record roomRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		return r.apply(record)
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// fileRoomRepository serves reads from memory and appends every write to the log file
+type fileRoomRepository struct {
+	*inMemoryRoomRepository
+	log *logFile
+}
+
+// apply replays a record on the in-memory state
+func (r *fileRoomRepository) apply(record roomRecord) error {
+	switch record.Op {
+	case opCreateRoom:
+		room := domain.Room{
+			ID:        record.ID,
+			Name:      record.Name,
+			CreatedBy: record.CreatedBy,
+		}
+		if record.CreatedAt != nil {
+			room.CreatedAt = *record.CreatedAt
+		}
+		return r.insert(room)
+	case opJoinRoom:
+		return r.addMember(record.ID, record.UserID)
+	case opLeaveRoom:
+		return r.removeMember(record.ID, record.UserID)
+	default:
+		return fmt.Errorf("unknown operation %q", record.Op)
+	}
+}
+
+// Insert implementation
+func (r *fileRoomRepository) Insert(room domain.Room) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rooms[room.ID]; ok {
+		return ErrDuplicateRoomID
+	}
+
+	err := r.log.append(roomRecord{
+		Op:        opCreateRoom,
+		ID:        room.ID,
+		Name:      room.Name,
+		CreatedBy: room.CreatedBy,
+		CreatedAt: &room.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.insert(room)
+}
+
+// AddMember implementation
+func (r *fileRoomRepository) AddMember(roomID int, userID int) error {
+	return r.updateMembership(opJoinRoom, roomID, userID)
+}
+
+// RemoveMember implementation
+func (r *fileRoomRepository) RemoveMember(roomID int, userID int) error {
+	return r.updateMembership(opLeaveRoom, roomID, userID)
+}
+
+func (r *fileRoomRepository) updateMembership(op string, roomID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members, ok := r.members[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	// skip the no-op updates to keep the log short
+	if _, isMember := members[userID]; isMember == (op == opJoinRoom) {
+		return nil
+	}
+
+	if err := r.log.append(roomRecord{Op: op, ID: roomID, UserID: userID}); err != nil {
+		return err
+	}
+
+	return r.apply(roomRecord{Op: op, ID: roomID, UserID: userID})
+}
+
+// Close implementation
+func (r *fileRoomRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.log.close()
+}
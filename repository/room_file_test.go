@@ -0,0 +1,60 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+func TestFileRoomRepositorySurvivesReopen(t *testing.T) {
+	path := filepath.Join(tempDir(t), "rooms.jsonl")
+
+	r, err := repository.OpenFileRoomRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room := domain.Room{ID: 1, Name: "general", CreatedBy: 100, CreatedAt: time.Date(2020, 5, 24, 10, 0, 0, 0, time.UTC)}
+	if err := r.Insert(room); err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []int{100, 200, 300} {
+		if err := r.AddMember(room.ID, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.RemoveMember(room.ID, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddMember(2, 100); err != repository.ErrRoomNotFound {
+		t.Errorf("AddMember() to unknown room: got err = %v, want %v", err, repository.ErrRoomNotFound)
+	}
+	r.Close()
+
+	r, err = repository.OpenFileRoomRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	got, err := r.Get(room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != room.ID || got.Name != room.Name || got.CreatedBy != room.CreatedBy || !got.CreatedAt.Equal(room.CreatedAt) {
+		t.Errorf("Get() = %+v, want %+v", got, room)
+	}
+
+	for userID, want := range map[int]bool{100: true, 200: false, 300: true, 400: false} {
+		if got := r.IsMember(room.ID, userID); got != want {
+			t.Errorf("IsMember(%d, %d) = %t, want %t", room.ID, userID, got, want)
+		}
+	}
+
+	if got, want := r.LastID(), 1; got != want {
+		t.Errorf("LastID() = %d, want %d", got, want)
+	}
+}
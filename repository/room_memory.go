@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// NewInMemoryRoomRepository returns RoomRepository which keeps the rooms in memory only
+func NewInMemoryRoomRepository() RoomRepository {
+	return newInMemoryRoomRepository()
+}
+
+func newInMemoryRoomRepository() *inMemoryRoomRepository {
+	return &inMemoryRoomRepository{
+		rooms:   make(map[int]domain.Room),
+		members: make(map[int]map[int]struct{}),
+	}
+}
+
+// inMemoryRoomRepository keeps the rooms and the set of members of every room
+type inMemoryRoomRepository struct {
+	mu      sync.RWMutex
+	rooms   map[int]domain.Room
+	members map[int]map[int]struct{}
+	lastID  int
+}
+
+// Insert implementation
+func (r *inMemoryRoomRepository) Insert(room domain.Room) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.insert(room)
+}
+
+func (r *inMemoryRoomRepository) insert(room domain.Room) error {
+	if _, ok := r.rooms[room.ID]; ok {
+		return ErrDuplicateRoomID
+	}
+
+	r.rooms[room.ID] = room
+	r.members[room.ID] = make(map[int]struct{})
+	if room.ID > r.lastID {
+		r.lastID = room.ID
+	}
+
+	return nil
+}
+
+// Get implementation
+func (r *inMemoryRoomRepository) Get(id int) (domain.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	room, ok := r.rooms[id]
+	if !ok {
+		return domain.Room{}, ErrRoomNotFound
+	}
+
+	return room, nil
+}
+
+// List implementation
+func (r *inMemoryRoomRepository) List() ([]domain.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rooms := make([]domain.Room, 0, len(r.rooms))
+	for _, room := range r.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].ID < rooms[j].ID
+	})
+
+	return rooms, nil
+}
+
+// LastID implementation
+func (r *inMemoryRoomRepository) LastID() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastID
+}
+
+// AddMember implementation
+func (r *inMemoryRoomRepository) AddMember(roomID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.addMember(roomID, userID)
+}
+
+func (r *inMemoryRoomRepository) addMember(roomID int, userID int) error {
+	members, ok := r.members[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	members[userID] = struct{}{}
+	return nil
+}
+
+// RemoveMember implementation
+func (r *inMemoryRoomRepository) RemoveMember(roomID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.removeMember(roomID, userID)
+}
+
+func (r *inMemoryRoomRepository) removeMember(roomID int, userID int) error {
+	members, ok := r.members[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	delete(members, userID)
+	return nil
+}
+
+// IsMember implementation
+func (r *inMemoryRoomRepository) IsMember(roomID int, userID int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.members[roomID][userID]
+	return ok
+}
+
+// Members implementation
+func (r *inMemoryRoomRepository) Members(roomID int) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members, ok := r.members[roomID]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+
+	userIDs := make([]int, 0, len(members))
+	for userID := range members {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+
+	return userIDs, nil
+}
+
+// Close implementation
+func (r *inMemoryRoomRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// ErrUserNotFound is returned when no profile has been stored for the requested user ID
+var ErrUserNotFound = errors.New("user not found")
+
+// UserRepository contract
+type UserRepository interface {
+	// Get returns the profile of the user or ErrUserNotFound
+	Get(id int) (domain.User, error)
+	// Put stores the profile of the user, replacing the previous one
+	Put(user domain.User) error
+	// Close releases the underlying resources
+	Close() error
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// userRecord is the on-disk representation of a stored profile, the last
+// record of a user wins. Every record is written as a single JSON line.
+type userRecord struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OpenFileUserRepository opens (or creates) an append-only profile log at path
+// and loads the stored profiles into memory
+func OpenFileUserRepository(path string) (UserRepository, error) {
+	log, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &fileUserRepository{
+		inMemoryUserRepository: newInMemoryUserRepository(),
+		log:                    log,
+	}
+
+	err = log.replay(func(line []byte) error {
+		var record userRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		r.users[record.ID] = record.toDomain()
+		return nil
+	})
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// fileUserRepository serves reads from memory and appends every write to the log file
+type fileUserRepository struct {
+	*inMemoryUserRepository
+	log *logFile
+}
+
+// Put implementation
+func (r *fileUserRepository) Put(user domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.log.append(newUserRecord(user)); err != nil {
+		return err
+	}
+
+	r.users[user.ID] = user
+	return nil
+}
+
+func newUserRecord(user domain.User) userRecord {
+	return userRecord{
+		ID:        user.ID,
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+func (u userRecord) toDomain() domain.User {
+	return domain.User{
+		ID:        u.ID,
+		Name:      u.Name,
+		AvatarURL: u.AvatarURL,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+// Close implementation
+func (r *fileUserRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.log.close()
+}
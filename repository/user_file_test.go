@@ -0,0 +1,58 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/repository"
+)
+
+func TestFileUserRepositorySurvivesReopen(t *testing.T) {
+	path := filepath.Join(tempDir(t), "users.jsonl")
+
+	r, err := repository.OpenFileUserRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updatedAt := time.Date(2020, 5, 24, 10, 0, 0, 0, time.UTC)
+	profiles := []domain.User{
+		{ID: 100, Name: "alice", UpdatedAt: updatedAt},
+		{ID: 200, Name: "bob", AvatarURL: "https://example.com/bob.png", UpdatedAt: updatedAt},
+		{ID: 100, Name: "Alice", AvatarURL: "https://example.com/alice.png", UpdatedAt: updatedAt.Add(time.Minute)},
+	}
+	for _, user := range profiles {
+		if err := r.Put(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = repository.OpenFileUserRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, want := range profiles[1:] {
+		got, err := r.Get(want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.UpdatedAt.Equal(want.UpdatedAt) {
+			t.Errorf("user %d: UpdatedAt = %v, want %v", want.ID, got.UpdatedAt, want.UpdatedAt)
+		}
+		got.UpdatedAt = want.UpdatedAt
+		if got != want {
+			t.Errorf("user %d: got %+v, want %+v", want.ID, got, want)
+		}
+	}
+
+	if _, err := r.Get(300); err != repository.ErrUserNotFound {
+		t.Errorf("missing user: got err = %v, want %v", err, repository.ErrUserNotFound)
+	}
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/gifff/chat-server/domain"
+)
+
+// NewInMemoryUserRepository returns UserRepository which keeps the profiles in memory only
+func NewInMemoryUserRepository() UserRepository {
+	return newInMemoryUserRepository()
+}
+
+func newInMemoryUserRepository() *inMemoryUserRepository {
+	return &inMemoryUserRepository{
+		users: make(map[int]domain.User),
+	}
+}
+
+// inMemoryUserRepository keeps the profiles by user ID
+type inMemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[int]domain.User
+}
+
+// Get implementation
+func (r *inMemoryUserRepository) Get(id int) (domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return domain.User{}, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// Put implementation
+func (r *inMemoryUserRepository) Put(user domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users[user.ID] = user
+	return nil
+}
+
+// Close implementation
+func (r *inMemoryUserRepository) Close() error {
+	return nil
+}
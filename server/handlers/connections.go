@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/wsgateway"
+)
+
+// ackParam tells whether the listener acknowledges the text messages it receives
+func ackParam(c echo.Context) (bool, error) {
+	param := c.QueryParam("ack")
+	if param == "" {
+		return false, nil
+	}
+
+	ack, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, badRequest("invalid_ack", "ack must be a boolean")
+	}
+
+	return ack, nil
+}
+
+// ListConnections handler
+func (h *Handlers) ListConnections(c echo.Context) error {
+	callerID, _ := c.Get("user_id").(int)
+
+	statuses := h.WebsocketGateway.DeliveryStatus(callerID)
+	resp := make([]model.ConnectionStatus, len(statuses))
+	for i, status := range statuses {
+		resp[i] = connectionStatus(status)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// ListUserConnections returns the number of connections of every connected
+// user in ascending order of user ID
+func (h *Handlers) ListUserConnections(c echo.Context) error {
+	if err := h.checkAdmin(c); err != nil {
+		return err
+	}
+
+	connectionsByUser := h.WebsocketGateway.ConnectionsByUser()
+	resp := make([]model.UserConnections, 0, len(connectionsByUser))
+	for userID, connections := range connectionsByUser {
+		resp = append(resp, model.UserConnections{UserID: userID, Connections: connections})
+	}
+	sort.Slice(resp, func(i, j int) bool {
+		return resp[i].UserID < resp[j].UserID
+	})
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func connectionStatus(status wsgateway.DeliveryStatus) model.ConnectionStatus {
+	return model.ConnectionStatus{
+		ID:          status.RegistrationID,
+		RoomID:      status.Subscription.RoomID,
+		Presence:    status.Subscription.Presence,
+		Ack:         status.Subscription.Ack,
+		Dispatched:  status.Dispatched,
+		Written:     status.Written,
+		WriteErrors: status.WriteErrors,
+		Dropped:     status.Dropped,
+		Queued:      status.Queued,
+		Acked:       status.Acked,
+		Pending:     status.Pending,
+		Retried:     status.Retried,
+		Expired:     status.Expired,
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// peerIDParam returns the other user of a /dms/:user_id route
+func peerIDParam(c echo.Context) (int, error) {
+	peerID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil || peerID < 1 {
+		return 0, badRequest("invalid_user_id", "user ID must be a positive number")
+	}
+
+	return peerID, nil
+}
+
+// SendDirectMessage handler
+func (h *Handlers) SendDirectMessage(c echo.Context) error {
+	peerID, err := peerIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	var reqBody model.Message
+	err = c.Bind(&reqBody)
+	if err != nil {
+		return badRequest("invalid_body", "request body must be a JSON message")
+	}
+
+	if reqBody.Type != model.TextMessage {
+		return badRequest("invalid_type", "message type must be text")
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	msg, err := h.ChatService.SendDirectMessage(reqBody.Message, userID, peerID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusCreated, model.MessageFromDomain(msg, h.UserService.Profile(userID), userID))
+}
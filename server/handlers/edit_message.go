@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// EditMessage handler
+func (h *Handlers) EditMessage(c echo.Context) error {
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return badRequest("invalid_message_id", "message ID must be a number")
+	}
+
+	var reqBody model.Message
+	if err := c.Bind(&reqBody); err != nil {
+		return badRequest("invalid_body", "request body must be a JSON message")
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	msg, err := h.ChatService.EditMessage(messageID, reqBody.Message, userID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, model.MessageFromDomain(msg, h.UserService.Profile(userID), userID))
+}
+
+// ListMessageRevisions handler
+func (h *Handlers) ListMessageRevisions(c echo.Context) error {
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return badRequest("invalid_message_id", "message ID must be a number")
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	revisions, err := h.ChatService.MessageRevisions(messageID, userID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	resp := make([]model.MessageRevision, len(revisions))
+	for i, rev := range revisions {
+		resp[i] = model.MessageRevisionFromDomain(rev)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/chatservice"
+	"github.com/gifff/chat-server/model"
+)
+
+func newHTTPError(status int, code string, message string) *echo.HTTPError {
+	return echo.NewHTTPError(status, model.Error{
+		Code:    code,
+		Message: message,
+	})
+}
+
+func badRequest(code string, message string) *echo.HTTPError {
+	return newHTTPError(http.StatusBadRequest, code, message)
+}
+
+// serviceError maps the errors returned by the ChatService into HTTP errors.
+// Unknown errors are returned as is and end up as internal server errors.
+func serviceError(err error) error {
+	switch err {
+	case chatservice.ErrEmptyMessage:
+		return badRequest("empty_message", err.Error())
+	case chatservice.ErrEmptyRoomName:
+		return badRequest("empty_room_name", err.Error())
+	case chatservice.ErrInvalidUserName:
+		return badRequest("invalid_name", err.Error())
+	case chatservice.ErrInvalidAvatarURL:
+		return badRequest("invalid_avatar_url", err.Error())
+	case chatservice.ErrInvalidRecipient:
+		return badRequest("invalid_recipient", err.Error())
+	case chatservice.ErrMessageNotFound:
+		return newHTTPError(http.StatusNotFound, "message_not_found", err.Error())
+	case chatservice.ErrNotMessageAuthor:
+		return newHTTPError(http.StatusForbidden, "not_message_author", err.Error())
+	case chatservice.ErrMessageRetracted:
+		return newHTTPError(http.StatusConflict, "message_retracted", err.Error())
+	case chatservice.ErrRoomNotFound:
+		return newHTTPError(http.StatusNotFound, "room_not_found", err.Error())
+	case chatservice.ErrNotRoomMember:
+		return newHTTPError(http.StatusForbidden, "not_room_member", err.Error())
+	case chatservice.ErrUserNotFound:
+		return newHTTPError(http.StatusNotFound, "user_not_found", err.Error())
+	case chatservice.ErrNotProfileOwner:
+		return newHTTPError(http.StatusForbidden, "not_profile_owner", err.Error())
+	case chatservice.ErrNotParticipant:
+		return newHTTPError(http.StatusForbidden, "not_participant", err.Error())
+	default:
+		return err
+	}
+}
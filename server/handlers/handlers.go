@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"github.com/gifff/chat-server/chatservice"
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/metrics"
+	"github.com/gifff/chat-server/websocket"
 	"github.com/gifff/chat-server/wsgateway"
 
 	gorillaWebsocket "github.com/gorilla/websocket"
@@ -11,4 +14,17 @@ type Handlers struct {
 	WSUpgrader       gorillaWebsocket.Upgrader // default value is ok
 	WebsocketGateway wsgateway.WebsocketGateway
 	ChatService      chatservice.ChatService
+	RoomService      chatservice.RoomService
+	UserService      chatservice.UserService
+	// SendQueue configures the send queue of every listening connection
+	SendQueue websocket.QueueOptions
+	// Heartbeat configures the pings of every listening connection, the ones
+	// which stop answering are unregistered
+	Heartbeat websocket.HeartbeatOptions
+	// Metrics records the listening connections and is exposed on /metrics
+	Metrics metrics.Registry
+	// Logger is the logger of the handlers and of the listening connections
+	Logger logger.Logger
+	// AdminUserIDs are the users allowed to change the log levels
+	AdminUserIDs []int
 }
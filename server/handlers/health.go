@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// Healthz tells that the server is alive
+func (h *Handlers) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, model.Health{Status: model.HealthOK})
+}
+
+// Readyz tells whether the server accepts new connections, which stops once a
+// drain started so that the load balancer sends the clients to other instances
+func (h *Handlers) Readyz(c echo.Context) error {
+	if h.WebsocketGateway.Draining() {
+		return c.JSON(http.StatusServiceUnavailable, model.Health{Status: model.HealthDraining})
+	}
+
+	return c.JSON(http.StatusOK, model.Health{Status: model.HealthReady})
+}
+
+func draining() *echo.HTTPError {
+	return newHTTPError(http.StatusServiceUnavailable, "draining", "the server is shutting down, connect to another instance")
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/repository"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// ListMessages handler
+func (h *Handlers) ListMessages(c echo.Context) error {
+	query, err := parseMessageQuery(c)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	messages, hasMore, err := h.ChatService.ListMessages(query, userID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	page := model.MessagePage{
+		Messages: make([]model.Message, len(messages)),
+	}
+	for i, msg := range messages {
+		page.Messages[i] = model.MessageFromDomain(msg, h.UserService.Profile(msg.UserID), userID)
+	}
+
+	if hasMore {
+		next := messages[0].ID
+		if query.Forward {
+			next = messages[len(messages)-1].ID
+		}
+		page.NextCursor = strconv.FormatInt(next, 10)
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+func parseMessageQuery(c echo.Context) (repository.MessageQuery, error) {
+	query := repository.MessageQuery{
+		Limit: defaultPageLimit,
+	}
+
+	var err error
+	query.RoomID, err = roomIDParam(c)
+	if err != nil {
+		return query, err
+	}
+	if c.Param("user_id") != "" {
+		peerID, err := peerIDParam(c)
+		if err != nil {
+			return query, err
+		}
+		userID, _ := c.Get("user_id").(int)
+		query.Between = [2]int{userID, peerID}
+	}
+	if v := c.QueryParam("before"); v != "" {
+		query.BeforeID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || query.BeforeID < 1 {
+			return query, badRequest("invalid_cursor", "before must be a positive message ID")
+		}
+	}
+	if v := c.QueryParam("after"); v != "" {
+		query.AfterID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || query.AfterID < 0 {
+			return query, badRequest("invalid_cursor", "after must be a message ID")
+		}
+		query.Forward = true
+	}
+	if query.BeforeID > 0 && query.Forward {
+		return query, badRequest("invalid_cursor", "before and after cannot be used together")
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		query.Limit, err = strconv.Atoi(v)
+		if err != nil || query.Limit < 1 || query.Limit > maxPageLimit {
+			return query, badRequest("invalid_limit", "limit must be between 1 and "+strconv.Itoa(maxPageLimit))
+		}
+	}
+
+	return query, nil
+}
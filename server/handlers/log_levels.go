@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/model"
+)
+
+// GetLogLevels returns the levels of the logger
+func (h *Handlers) GetLogLevels(c echo.Context) error {
+	if err := h.checkAdmin(c); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, logLevels(h.Logger.Levels()))
+}
+
+// UpdateLogLevel changes the default level or the level of a component while
+// the server runs, and returns the levels of the logger
+func (h *Handlers) UpdateLogLevel(c echo.Context) error {
+	if err := h.checkAdmin(c); err != nil {
+		return err
+	}
+
+	var update model.LogLevelUpdate
+	if err := c.Bind(&update); err != nil {
+		return badRequest("invalid_body", "body must be a log level update")
+	}
+
+	levels := h.Logger.Levels()
+	switch {
+	case update.Level == "" && update.Component != "":
+		levels.ResetLevel(update.Component)
+	default:
+		level, err := logger.ParseLevel(update.Level)
+		if err != nil {
+			return badRequest("invalid_level", err.Error())
+		}
+
+		if update.Component == "" {
+			levels.SetDefault(level)
+		} else {
+			levels.SetLevel(update.Component, level)
+		}
+	}
+
+	h.requestLogger(c).Infof("Log level of %q set to %q", update.Component, update.Level)
+
+	return c.JSON(http.StatusOK, logLevels(levels))
+}
+
+func (h *Handlers) checkAdmin(c echo.Context) error {
+	userID, _ := c.Get("user_id").(int)
+	for _, adminID := range h.AdminUserIDs {
+		if userID == adminID {
+			return nil
+		}
+	}
+
+	return newHTTPError(http.StatusForbidden, "not_admin", "only the administrators can do this")
+}
+
+func logLevels(levels logger.Levels) model.LogLevels {
+	components := make(map[string]string)
+	for component, level := range levels.Components() {
+		components[component] = level.String()
+	}
+
+	return model.LogLevels{
+		Default:    levels.Default().String(),
+		Components: components,
+	}
+}
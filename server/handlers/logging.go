@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/logger"
+)
+
+// requestLogger returns the logger of the http component with the ID and the
+// user of the request
+func (h *Handlers) requestLogger(c echo.Context) logger.Logger {
+	fields := logger.Fields{}
+	if requestID, _ := c.Get("request_id").(string); requestID != "" {
+		fields[logger.RequestIDField] = requestID
+	}
+	if userID, ok := c.Get("user_id").(int); ok {
+		fields[logger.UserIDField] = userID
+	}
+
+	return h.Logger.Component("http").With(fields)
+}
@@ -1,42 +1,133 @@
 package handlers
 
 import (
-	"log"
+	"net"
+	"net/http"
 
 	"github.com/labstack/echo"
 
+	"github.com/gifff/chat-server/logger"
 	"github.com/gifff/chat-server/model"
 	"github.com/gifff/chat-server/websocket"
+	"github.com/gifff/chat-server/wsgateway"
 )
 
 // MessageListener is a websocket handler
 func (h *Handlers) MessageListener(c echo.Context) error {
-	ws, err := h.WSUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	roomID, err := roomIDParam(c)
 	if err != nil {
 		return err
 	}
 
+	since, resuming, err := sinceParam(c)
+	if err != nil {
+		return err
+	}
+
+	presence, err := presenceParam(c)
+	if err != nil {
+		return err
+	}
+
+	ack, err := ackParam(c)
+	if err != nil {
+		return err
+	}
+
+	if h.WebsocketGateway.Draining() {
+		return draining()
+	}
+
 	userID, _ := c.Get("user_id").(int)
-	conn := websocket.NewConnectionDispatcher(ws)
-	registrationID := h.WebsocketGateway.RegisterConnection(userID, conn)
+	if err := h.RoomService.CheckMember(roomID, userID); err != nil {
+		return serviceError(err)
+	}
+
+	var responseHeader http.Header
+	if subprotocol, _ := c.Get("subprotocol").(string); subprotocol != "" {
+		// the client must see the subprotocol it offered echoed back, otherwise
+		// browsers fail the handshake
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {subprotocol}}
+	}
+
+	log := h.requestLogger(c)
+
+	ws, err := h.WSUpgrader.Upgrade(c.Response(), c.Request(), responseHeader)
+	if err != nil {
+		h.Metrics.UpgradeFailed()
+		log.Debugf("Unable to upgrade: %v", err)
+		return err
+	}
+
+	conn := websocket.NewConnectionDispatcher(ws, h.SendQueue, h.Heartbeat, h.Metrics, log)
+	registrationID := h.WebsocketGateway.RegisterConnection(userID, wsgateway.Subscription{
+		RoomID:   roomID,
+		Presence: presence,
+		Ack:      ack,
+		Resume:   resuming,
+	}, conn)
+	log = log.With(logger.Fields{logger.ConnectionIDField: registrationID})
 
 	defer func() {
 		h.WebsocketGateway.UnregisterConnection(userID, registrationID)
 		ws.Close()
 	}()
 
+	if resuming {
+		if err := h.replayMissedMessages(registrationID, roomID, userID, since); err != nil {
+			log.Errorf("Unable to replay missed messages: %v", err)
+			return nil
+		}
+	}
+
+	// the pongs are only handled while reading, so the deadline starts after the replay
+	websocket.ExpectPongs(ws, h.Heartbeat)
+
 	for {
 		var msg model.Message
 		err := ws.ReadJSON(&msg)
 		if err != nil {
-			log.Printf("[DEBUG] Error while reading message [userID: %d] : %v\n", userID, err)
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				log.Infof("Heartbeat timed out, dropping connection")
+				break
+			}
+
+			log.Debugf("Error while reading message: %v", err)
 			break
 		}
 
-		log.Printf("[DEBUG] Message [userID: %d]: %+v\n", userID, msg)
+		msgLog := log
+		if msg.ID != 0 {
+			msgLog = log.With(logger.Fields{logger.MessageIDField: msg.ID})
+		}
+		msgLog.Debugf("Received %s message", msg.Type)
+		h.Metrics.MessageReceived(msg.Type)
+
+		switch msg.Type {
+		case model.TextMessage:
+			if msg.ToUserID != 0 {
+				_, err = h.ChatService.SendDirectMessage(msg.Message, userID, msg.ToUserID)
+			} else {
+				_, err = h.ChatService.SendMessage(msg.Message, userID, roomID)
+			}
+		case model.RetractMessage:
+			err = h.ChatService.RetractMessage(msg.ID, userID)
+		case model.EditMessage:
+			_, err = h.ChatService.EditMessage(msg.ID, msg.Message, userID)
+		case model.TypingMessage:
+			err = h.ChatService.SendTyping(userID, roomID, msg.ToUserID)
+		case model.ReadMessage:
+			err = h.ChatService.MarkRead(userID, roomID, msg.ToUserID, msg.ID)
+		case model.AckMessage:
+			if !h.WebsocketGateway.Ack(userID, registrationID, msg.ID) {
+				msgLog.Debugf("Unexpected ack")
+			}
+		default:
+			continue
+		}
 
-		if msg.Type != model.UnknownMessage {
-			h.ChatService.SendMessage(msg.Message, userID)
+		if err != nil {
+			msgLog.Debugf("Unable to handle message: %v", err)
 		}
 	}
 
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/metrics"
+)
+
+// ExposeMetrics writes the metrics in the Prometheus text exposition format
+func (h *Handlers) ExposeMetrics(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, metrics.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+
+	if err := h.Metrics.Expose(c.Response()); err != nil {
+		h.requestLogger(c).Debugf("Unable to write the metrics: %v", err)
+	}
+
+	return nil
+}
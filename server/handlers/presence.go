@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// presenceParam tells whether the listener subscribes to the presence events
+func presenceParam(c echo.Context) (bool, error) {
+	param := c.QueryParam("presence")
+	if param == "" {
+		return false, nil
+	}
+
+	presence, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, badRequest("invalid_presence", "presence must be a boolean")
+	}
+
+	return presence, nil
+}
+
+// ListOnlineUsers handler
+func (h *Handlers) ListOnlineUsers(c echo.Context) error {
+	callerID, _ := c.Get("user_id").(int)
+
+	userIDs := h.WebsocketGateway.OnlineUsers()
+	resp := make([]model.User, len(userIDs))
+	for i, userID := range userIDs {
+		resp[i] = model.UserFromDomain(h.UserService.Profile(userID), callerID)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// MarkRead handler
+func (h *Handlers) MarkRead(c echo.Context) error {
+	roomID, err := roomIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	var peerID int
+	if c.Param("user_id") != "" {
+		if peerID, err = peerIDParam(c); err != nil {
+			return err
+		}
+	}
+
+	var reqBody model.Message
+	if err := c.Bind(&reqBody); err != nil {
+		return badRequest("invalid_body", "request body must be a JSON message")
+	}
+
+	if reqBody.ID < 1 {
+		return badRequest("invalid_message_id", "message ID must be a positive number")
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	if err := h.ChatService.MarkRead(userID, roomID, peerID, reqBody.ID); err != nil {
+		return serviceError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUnread handler
+func (h *Handlers) GetUnread(c echo.Context) error {
+	userID, _ := c.Get("user_id").(int)
+	counts, err := h.ChatService.UnreadCounts(userID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, model.UnreadFromDomain(counts))
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/repository"
+)
+
+// sinceParam returns the last message ID seen by a resuming client and whether
+// the client asked to resume at all
+func sinceParam(c echo.Context) (int64, bool, error) {
+	param := c.QueryParam("since")
+	if param == "" {
+		return 0, false, nil
+	}
+
+	since, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || since < 0 {
+		return 0, false, badRequest("invalid_since", "since must be a message ID")
+	}
+
+	return since, true, nil
+}
+
+// replayMissedMessages replays in order the messages of the room and the direct
+// messages of the user sent after the since message ID, then resumes live delivery
+func (h *Handlers) replayMissedMessages(registrationID int, roomID int, userID int, since int64) error {
+	defer h.WebsocketGateway.Resume(userID, registrationID)
+
+	query := repository.MessageQuery{
+		RoomID:       roomID,
+		WithDirectOf: userID,
+		AfterID:      since,
+		Limit:        maxPageLimit,
+		Forward:      true,
+	}
+
+	for {
+		messages, hasMore, err := h.ChatService.ListMessages(query, userID)
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range messages {
+			// the connection is gone, the rest would never be written
+			if !h.WebsocketGateway.Replay(userID, registrationID, model.MessageFromDomain(msg, h.UserService.Profile(msg.UserID), userID)) {
+				return nil
+			}
+		}
+
+		if !hasMore {
+			return nil
+		}
+		query.AfterID = messages[len(messages)-1].ID
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+// RetractMessage handler
+func (h *Handlers) RetractMessage(c echo.Context) error {
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return badRequest("invalid_message_id", "message ID must be a number")
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	if err := h.ChatService.RetractMessage(messageID, userID); err != nil {
+		return serviceError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/model"
+)
+
+// roomIDParam returns the room of the route, routes outside of /rooms/:room_id
+// belong to the global room
+func roomIDParam(c echo.Context) (int, error) {
+	param := c.Param("room_id")
+	if param == "" {
+		return domain.GlobalRoomID, nil
+	}
+
+	roomID, err := strconv.Atoi(param)
+	if err != nil || roomID < 1 {
+		return 0, badRequest("invalid_room_id", "room ID must be a positive number")
+	}
+
+	return roomID, nil
+}
+
+// ListRooms handler
+func (h *Handlers) ListRooms(c echo.Context) error {
+	rooms, err := h.RoomService.ListRooms()
+	if err != nil {
+		return serviceError(err)
+	}
+
+	resp := make([]model.Room, len(rooms))
+	for i, room := range rooms {
+		resp[i] = model.RoomFromDomain(room)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// CreateRoom handler
+func (h *Handlers) CreateRoom(c echo.Context) error {
+	var reqBody model.Room
+	if err := c.Bind(&reqBody); err != nil {
+		return badRequest("invalid_body", "request body must be a JSON room")
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	room, err := h.RoomService.CreateRoom(reqBody.Name, userID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusCreated, model.RoomFromDomain(room))
+}
+
+// GetRoom handler
+func (h *Handlers) GetRoom(c echo.Context) error {
+	roomID, err := roomIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	room, err := h.RoomService.GetRoom(roomID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, model.RoomFromDomain(room))
+}
+
+// JoinRoom handler
+func (h *Handlers) JoinRoom(c echo.Context) error {
+	roomID, err := roomIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	if err := h.RoomService.JoinRoom(roomID, userID); err != nil {
+		return serviceError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LeaveRoom handler
+func (h *Handlers) LeaveRoom(c echo.Context) error {
+	roomID, err := roomIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	if err := h.RoomService.LeaveRoom(roomID, userID); err != nil {
+		return serviceError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/labstack/echo"
 
 	"github.com/gifff/chat-server/model"
@@ -8,12 +10,26 @@ import (
 
 // SendMessage handler
 func (h *Handlers) SendMessage(c echo.Context) error {
+	roomID, err := roomIDParam(c)
+	if err != nil {
+		return err
+	}
+
 	var reqBody model.Message
-	err := c.Bind(&reqBody)
+	err = c.Bind(&reqBody)
+	if err != nil {
+		return badRequest("invalid_body", "request body must be a JSON message")
+	}
+
+	if reqBody.Type != model.TextMessage {
+		return badRequest("invalid_type", "message type must be text")
+	}
+
+	userID, _ := c.Get("user_id").(int)
+	msg, err := h.ChatService.SendMessage(reqBody.Message, userID, roomID)
 	if err != nil {
-		return echo.ErrBadRequest
+		return serviceError(err)
 	}
 
-	// reqBody.Message
-	return nil
+	return c.JSON(http.StatusCreated, model.MessageFromDomain(msg, h.UserService.Profile(userID), userID))
 }
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/model"
+)
+
+func userIDParam(c echo.Context) (int, error) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID < 1 {
+		return 0, badRequest("invalid_user_id", "user ID must be a positive number")
+	}
+
+	return userID, nil
+}
+
+// GetUser handler
+func (h *Handlers) GetUser(c echo.Context) error {
+	userID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.UserService.GetUser(userID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	callerID, _ := c.Get("user_id").(int)
+	return c.JSON(http.StatusOK, model.UserFromDomain(user, callerID))
+}
+
+// UpdateUser handler
+func (h *Handlers) UpdateUser(c echo.Context) error {
+	userID, err := userIDParam(c)
+	if err != nil {
+		return err
+	}
+
+	var reqBody model.User
+	if err := c.Bind(&reqBody); err != nil {
+		return badRequest("invalid_body", "request body must be a JSON user")
+	}
+
+	callerID, _ := c.Get("user_id").(int)
+	user, err := h.UserService.UpdateUser(userID, reqBody.Name, reqBody.AvatarURL, callerID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, model.UserFromDomain(user, callerID))
+}
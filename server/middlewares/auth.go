@@ -1,16 +1,92 @@
 package middlewares
 
 import (
-	"strconv"
+	"net/http"
+	"strings"
 
 	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/auth"
+	"github.com/gifff/chat-server/model"
+)
+
+const (
+	// TokenQueryParam is the query parameter carrying the credential for clients
+	// which cannot set headers, such as websocket clients in browsers
+	TokenQueryParam = "access_token"
+	// TokenSubprotocol is the websocket subprotocol announcing that the next offered
+	// subprotocol is the credential, i.e: Sec-WebSocket-Protocol: access_token, <token>
+	TokenSubprotocol = "access_token"
 )
 
-// AuthenticationExtractor is a middleware to extract value from X-User-Id header and set into the Echo context
-func AuthenticationExtractor(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		userID, _ := strconv.Atoi(c.Request().Header.Get("X-User-Id"))
-		c.Set("user_id", userID)
-		return next(c)
+// Authentication is a middleware to authenticate the request credential and set the
+// resolved user ID into the Echo context. The credential is taken from, in order, the
+// Authorization bearer header, the access_token query parameter and the websocket
+// subprotocols. Requests without valid credential are rejected with 401 before
+// reaching the handlers, hence before any websocket upgrade. The routes in
+// publicPaths, such as the metrics scraped by Prometheus, are not authenticated.
+func Authentication(authenticator auth.Authenticator, publicPaths ...string) echo.MiddlewareFunc {
+	public := make(map[string]bool, len(publicPaths))
+	for _, path := range publicPaths {
+		public[path] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if public[c.Path()] {
+				return next(c)
+			}
+
+			credential, viaSubprotocol := extractCredential(c.Request())
+			if credential == "" {
+				return unauthorized("missing_credentials", "credentials are required")
+			}
+
+			userID, err := authenticator.Authenticate(credential)
+			switch err {
+			case nil:
+			case auth.ErrExpiredCredentials:
+				return unauthorized("expired_credentials", err.Error())
+			default:
+				return unauthorized("invalid_credentials", auth.ErrInvalidCredentials.Error())
+			}
+
+			c.Set("user_id", userID)
+			if viaSubprotocol {
+				c.Set("subprotocol", TokenSubprotocol)
+			}
+
+			return next(c)
+		}
 	}
 }
+
+func extractCredential(r *http.Request) (credential string, viaSubprotocol bool) {
+	if h := r.Header.Get(echo.HeaderAuthorization); h != "" {
+		const prefix = "Bearer "
+		if len(h) > len(prefix) && strings.EqualFold(h[:len(prefix)], prefix) {
+			return strings.TrimSpace(h[len(prefix):]), false
+		}
+		return "", false
+	}
+
+	if token := r.URL.Query().Get(TokenQueryParam); token != "" {
+		return token, false
+	}
+
+	protocols := strings.Split(r.Header.Get("Sec-Websocket-Protocol"), ",")
+	for i := 0; i < len(protocols)-1; i++ {
+		if strings.TrimSpace(protocols[i]) == TokenSubprotocol {
+			return strings.TrimSpace(protocols[i+1]), true
+		}
+	}
+
+	return "", false
+}
+
+func unauthorized(code string, message string) *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusUnauthorized, model.Error{
+		Code:    code,
+		Message: message,
+	})
+}
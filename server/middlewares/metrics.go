@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/gifff/chat-server/metrics"
+)
+
+// Metrics is a middleware observing the duration of every request by route.
+// It handles the errors of the next handlers itself so that their status is known.
+func Metrics(m metrics.Metrics) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			m.RequestHandled(c.Request().Method, route, c.Response().Status, time.Since(start))
+
+			return nil
+		}
+	}
+}
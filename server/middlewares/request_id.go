@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/labstack/echo"
+)
+
+// RequestID is a middleware setting the request ID into the Echo context and
+// the X-Request-ID response header. The ID sent by the client, i.e: by a
+// proxy in front of the server, is kept, otherwise a random one is generated.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if id == "" || len(id) > 128 {
+				id = newRequestID()
+			}
+
+			c.Set("request_id", id)
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+			return next(c)
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -2,10 +2,11 @@ package server
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/gifff/chat-server/auth"
+	"github.com/gifff/chat-server/logger"
 	"github.com/gifff/chat-server/server/handlers"
 	"github.com/gifff/chat-server/server/middlewares"
 
@@ -13,18 +14,55 @@ import (
 )
 
 // New instantiates Server instance
-func New(e *echo.Echo, port string, h handlers.Handlers) *Server {
+func New(e *echo.Echo, port string, h handlers.Handlers, authenticator auth.Authenticator) *Server {
 	if port == "" {
 		port = ":8080"
 	}
 
-	e.Use(middlewares.AuthenticationExtractor)
+	e.Use(middlewares.RequestID())
+	e.Use(middlewares.Metrics(h.Metrics))
+	e.Use(middlewares.Authentication(authenticator, "/metrics", "/healthz", "/readyz"))
+	e.GET("/metrics", h.ExposeMetrics)
+	e.GET("/healthz", h.Healthz)
+	e.GET("/readyz", h.Readyz)
+
 	e.GET("/messages/listen", h.MessageListener)
+	e.GET("/messages", h.ListMessages)
 	e.POST("/messages", h.SendMessage)
+	e.POST("/messages/read", h.MarkRead)
+	e.PATCH("/messages/:id", h.EditMessage)
+	e.DELETE("/messages/:id", h.RetractMessage)
+	e.GET("/messages/:id/revisions", h.ListMessageRevisions)
+
+	e.GET("/rooms", h.ListRooms)
+	e.POST("/rooms", h.CreateRoom)
+	e.GET("/rooms/:room_id", h.GetRoom)
+	e.POST("/rooms/:room_id/members", h.JoinRoom)
+	e.DELETE("/rooms/:room_id/members", h.LeaveRoom)
+	e.GET("/rooms/:room_id/messages/listen", h.MessageListener)
+	e.GET("/rooms/:room_id/messages", h.ListMessages)
+	e.POST("/rooms/:room_id/messages", h.SendMessage)
+	e.POST("/rooms/:room_id/messages/read", h.MarkRead)
+
+	e.GET("/presence", h.ListOnlineUsers)
+	e.GET("/connections", h.ListConnections)
+	e.GET("/users/:id", h.GetUser)
+	e.PUT("/users/:id", h.UpdateUser)
+
+	e.GET("/dms/:user_id/messages", h.ListMessages)
+	e.POST("/dms/:user_id/messages", h.SendDirectMessage)
+	e.POST("/dms/:user_id/messages/read", h.MarkRead)
+
+	e.GET("/unread", h.GetUnread)
+
+	e.GET("/admin/connections", h.ListUserConnections)
+	e.GET("/admin/log-levels", h.GetLogLevels)
+	e.PUT("/admin/log-levels", h.UpdateLogLevel)
 
 	return &Server{
 		e:    e,
 		port: port,
+		log:  h.Logger.Component("http"),
 	}
 }
 
@@ -32,6 +70,7 @@ func New(e *echo.Echo, port string, h handlers.Handlers) *Server {
 type Server struct {
 	e    *echo.Echo
 	port string
+	log  logger.Logger
 }
 
 // Start fires up the Echo server
@@ -39,7 +78,7 @@ func (s *Server) Start() <-chan struct{} {
 	ch := make(chan struct{}, 1)
 	go func() {
 		if err := s.e.Start(s.port); err != nil && err != http.ErrServerClosed {
-			log.Printf("[ERROR] got error when starting server: %s", err)
+			s.log.Errorf("got error when starting server: %s", err)
 			ch <- struct{}{}
 		}
 
@@ -55,6 +94,6 @@ func (s *Server) Stop(timeout time.Duration) {
 	defer cancel()
 
 	if err := s.e.Shutdown(ctx); err != nil {
-		log.Printf("[ERROR] error when shutting down: %s", err)
+		s.log.Errorf("error when shutting down: %s", err)
 	}
 }
@@ -1,10 +1,18 @@
 package server_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,20 +20,174 @@ import (
 	"github.com/labstack/echo"
 	"github.com/posener/wstest"
 
+	"github.com/gifff/chat-server/auth"
 	"github.com/gifff/chat-server/deps"
+	"github.com/gifff/chat-server/logger"
 	"github.com/gifff/chat-server/model"
 	"github.com/gifff/chat-server/server"
 	"github.com/gifff/chat-server/server/handlers"
+	chatWebsocket "github.com/gifff/chat-server/websocket"
+	"github.com/gifff/chat-server/wsclient"
+	"github.com/gifff/chat-server/wsgateway"
 )
 
-var hs handlers.Handlers
+const jwtSecret = "integration-test-secret"
+
+// adminUserID is allowed to change the log levels
+const adminUserID = 891
+
+const (
+	presenceGracePeriod = 100 * time.Millisecond
+	ackTimeout          = 50 * time.Millisecond
+	maxDeliveryRetries  = 2
+)
+
+var (
+	hs            handlers.Handlers
+	authenticator auth.Authenticator
+)
 
 func init() {
-	wgw, chatSvc := deps.BuildDependencies()
+	// every entry is built, so that logging is exercised too, then discarded
+	l, err := logger.New(ioutil.Discard, logger.JSONFormat, logger.NewLevels(logger.DebugLevel, nil))
+	if err != nil {
+		panic(err)
+	}
+
+	d, err := deps.BuildDependencies(deps.Config{
+		Auth:      deps.JWTAuth,
+		JWTSecret: jwtSecret,
+
+		Gateway: wsgateway.Options{
+			PresenceGracePeriod: presenceGracePeriod,
+			AckTimeout:          ackTimeout,
+			MaxDeliveryRetries:  maxDeliveryRetries,
+		},
+
+		Logger: l,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	authenticator = d.Authenticator
+
 	hs = handlers.Handlers{
-		WebsocketGateway: wgw,
-		ChatService:      chatSvc,
+		WebsocketGateway: d.WebsocketGateway,
+		ChatService:      d.ChatService,
+		RoomService:      d.RoomService,
+		UserService:      d.UserService,
+		Metrics:          d.Metrics,
+		Logger:           d.Logger,
+		AdminUserIDs:     []int{adminUserID},
+	}
+}
+
+// waitForConnections blocks until the gateway has registered exactly n connections.
+// The websocket handshake completes before the server registers the connection,
+// so a dialed client is not guaranteed to receive broadcasts right away.
+func waitForConnections(t *testing.T, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for hs.WebsocketGateway.TotalConnections() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d connections, got %d", n, hs.WebsocketGateway.TotalConnections())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receivePresence keeps reading the presence events received by the connection,
+// so that the events of the users of the previous tests, whose grace period
+// elapses meanwhile, cannot stall the gateway
+func receivePresence(c *websocket.Conn) <-chan model.Message {
+	events := make(chan model.Message, 100)
+	go func() {
+		defer close(events)
+		for {
+			var msg model.Message
+			if err := c.ReadJSON(&msg); err != nil {
+				return
+			}
+			events <- msg
+		}
+	}()
+
+	return events
+}
+
+// readPresence returns the next presence event of the user, skipping the events of other users
+func readPresence(t *testing.T, events <-chan model.Message, userID int) model.Message {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-events:
+			if !ok {
+				t.Fatal("connection closed while waiting for a presence event")
+			}
+			if msg.Type != model.PresenceMessage {
+				t.Fatalf("received %+v, want a presence event", msg)
+			}
+			if msg.User.ID == userID {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for a presence event of %d", userID)
+		}
+	}
+}
+
+// onlineUsers returns the set of users listed by GET /presence
+func onlineUsers(t *testing.T, e *echo.Echo) map[int]bool {
+	t.Helper()
+
+	var users []model.User
+	rec := doRequest(e, http.MethodGet, "/presence", "", 1)
+	if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+
+	online := make(map[int]bool)
+	for _, u := range users {
+		online[u.ID] = true
+	}
+	return online
+}
+
+// stripTimestamp asserts the message is timestamped and then zeroes the timestamp
+// so the message can be compared with an expected value
+func stripTimestamp(t *testing.T, msg model.Message) model.Message {
+	if msg.Timestamp.IsZero() {
+		t.Errorf("message %d: timestamp is not set", msg.ID)
+	}
+	msg.Timestamp = time.Time{}
+	return msg
+}
+
+// authHeader returns request header carrying a token of userID
+func authHeader(userID int) http.Header {
+	token, err := auth.NewJWT([]byte(jwtSecret), userID, time.Time{})
+	if err != nil {
+		panic(err)
+	}
+
+	header := http.Header{}
+	header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	return header
+}
+
+// doRequest serves an HTTP request on behalf of userID and returns the recorded response
+func doRequest(e *echo.Echo, method, target, body string, userID int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	}
+	req.Header.Set(echo.HeaderAuthorization, authHeader(userID).Get(echo.HeaderAuthorization))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
 }
 
 func closeConnection(c *websocket.Conn) error {
@@ -42,7 +204,7 @@ func closeConnection(c *websocket.Conn) error {
 
 func TestMessageListenerHandler(t *testing.T) {
 	e := echo.New()
-	_ = server.New(e, "", hs)
+	_ = server.New(e, "", hs, authenticator)
 
 	senderOutgoingMessages := []model.Message{
 		{
@@ -101,38 +263,32 @@ func TestMessageListenerHandler(t *testing.T) {
 		},
 	}
 
-	/*
-		NOTE:
-		Must run the test with flag -parallel <number of clients + 1>
-		It is because the test is parallel with the number of clienst and the sender itself.
-		Otherwise, the test will fail because some of the clients won't get the message from the sender
-		and it will cause locking.
-	*/
 	numberOfClients := 9
-	wg := sync.WaitGroup{}
-	wg.Add(numberOfClients)
+	// the clients read while the sender writes, each one on its own goroutine
+	var connected, done sync.WaitGroup
+	connected.Add(numberOfClients)
+	done.Add(numberOfClients)
 	for i := 1; i <= numberOfClients; i++ {
 
 		userID := i * 100
 
-		t.Run(fmt.Sprintf("client_%d", userID), func(t *testing.T) {
-			t.Parallel()
+		go func() {
+			defer done.Done()
 
-			requestHeader := http.Header{}
-			requestHeader.Set("X-User-Id", strconv.Itoa(userID))
+			requestHeader := authHeader(userID)
 
 			d := wstest.NewDialer(e)
 			c, resp, err := d.Dial("ws://whatever/messages/listen", requestHeader)
+			connected.Done()
 			if err != nil {
-				t.Fatal(err)
+				t.Errorf("client_%d: %v", userID, err)
+				return
 			}
 
-			wg.Done()
-
 			defer closeConnection(c)
 
 			if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
-				t.Errorf("resp.StatusCode = %q, want %q", got, want)
+				t.Errorf("client_%d: resp.StatusCode = %q, want %q", userID, got, want)
 			}
 
 			var msg model.Message
@@ -140,63 +296,62 @@ func TestMessageListenerHandler(t *testing.T) {
 			for i, expectedMessage := range clientExpectedIncomingMessages {
 				err = c.ReadJSON(&msg)
 				if err != nil {
-					t.Fatal(err)
+					t.Errorf("client_%d: %v", userID, err)
+					return
 				}
 
-				if msg != expectedMessage {
-					t.Errorf("message [%d]: got = %+v, want %+v", i, msg, expectedMessage)
+				if msg := stripTimestamp(t, msg); msg != expectedMessage {
+					t.Errorf("client_%d: message [%d]: got = %+v, want %+v", userID, i, msg, expectedMessage)
 				}
 			}
-		})
+		}()
 	}
 
-	t.Run("sender", func(t *testing.T) {
-		t.Parallel()
+	connected.Wait()
+	waitForConnections(t, numberOfClients)
 
-		wg.Wait()
+	requestHeader := authHeader(1337)
 
-		requestHeader := http.Header{}
-		requestHeader.Set("X-User-Id", "1337")
+	d := wstest.NewDialer(e)
+	c, resp, err := d.Dial("ws://whatever/messages/listen", requestHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		d := wstest.NewDialer(e)
-		c, resp, err := d.Dial("ws://whatever/messages/listen", requestHeader)
+	defer closeConnection(c)
+
+	if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
+		t.Errorf("resp.StatusCode = %q, want %q", got, want)
+	}
+
+	for i := range senderOutgoingMessages {
+		outgoingMsg := senderOutgoingMessages[i]
+
+		err = c.WriteJSON(&outgoingMsg)
 		if err != nil {
 			t.Fatal(err)
 		}
+	}
 
-		defer closeConnection(c)
+	for i := range senderExpectedIncomingMessages {
+		expectedIncomingMsg := senderExpectedIncomingMessages[i]
 
-		if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
-			t.Errorf("resp.StatusCode = %q, want %q", got, want)
+		var incomingMsg model.Message
+		err = c.ReadJSON(&incomingMsg)
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		for i := range senderOutgoingMessages {
-			outgoingMsg := senderOutgoingMessages[i]
-
-			err = c.WriteJSON(&outgoingMsg)
-			if err != nil {
-				t.Fatal(err)
-			}
+		if incomingMsg := stripTimestamp(t, incomingMsg); incomingMsg != expectedIncomingMsg {
+			t.Errorf("incoming message: got = %+v, want %+v", incomingMsg, expectedIncomingMsg)
 		}
+	}
 
-		for i := range senderExpectedIncomingMessages {
-			expectedIncomingMsg := senderExpectedIncomingMessages[i]
-
-			var incomingMsg model.Message
-			err = c.ReadJSON(&incomingMsg)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			if incomingMsg != expectedIncomingMsg {
-				t.Errorf("incoming message: got = %+v, want %+v", incomingMsg, expectedIncomingMsg)
-			}
-		}
-	})
+	done.Wait()
 }
 func TestMessageListenerHandlerMultipleConnectionPerClient(t *testing.T) {
 	e := echo.New()
-	_ = server.New(e, "", hs)
+	_ = server.New(e, "", hs, authenticator)
 
 	senderOutgoingMessages := []model.Message{
 		{
@@ -256,30 +411,31 @@ func TestMessageListenerHandlerMultipleConnectionPerClient(t *testing.T) {
 	}
 
 	numberOfClients := 4
-	wg := sync.WaitGroup{}
-	wg.Add(numberOfClients)
+	// the clients read while the sender writes, each one on its own goroutine
+	var connected, done sync.WaitGroup
+	connected.Add(numberOfClients)
+	done.Add(numberOfClients)
 	for i := 1; i <= numberOfClients; i++ {
 
 		userID := 100
 
-		t.Run(fmt.Sprintf("client_%d", userID), func(t *testing.T) {
-			t.Parallel()
+		go func() {
+			defer done.Done()
 
-			requestHeader := http.Header{}
-			requestHeader.Set("X-User-Id", strconv.Itoa(userID))
+			requestHeader := authHeader(userID)
 
 			d := wstest.NewDialer(e)
 			c, resp, err := d.Dial("ws://whatever/messages/listen", requestHeader)
+			connected.Done()
 			if err != nil {
-				t.Fatal(err)
+				t.Errorf("client_%d: %v", userID, err)
+				return
 			}
 
-			wg.Done()
-
 			defer closeConnection(c)
 
 			if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
-				t.Errorf("resp.StatusCode = %q, want %q", got, want)
+				t.Errorf("client_%d: resp.StatusCode = %q, want %q", userID, got, want)
 			}
 
 			var msg model.Message
@@ -287,57 +443,2374 @@ func TestMessageListenerHandlerMultipleConnectionPerClient(t *testing.T) {
 			for i, expectedMessage := range clientExpectedIncomingMessages {
 				err = c.ReadJSON(&msg)
 				if err != nil {
-					t.Fatal(err)
+					t.Errorf("client_%d: %v", userID, err)
+					return
 				}
 
-				if msg != expectedMessage {
-					t.Errorf("message [%d]: got = %+v, want %+v", i, msg, expectedMessage)
+				if msg := stripTimestamp(t, msg); msg != expectedMessage {
+					t.Errorf("client_%d: message [%d]: got = %+v, want %+v", userID, i, msg, expectedMessage)
 				}
 			}
-		})
+		}()
 	}
 
-	t.Run("sender", func(t *testing.T) {
-		t.Parallel()
+	connected.Wait()
+	waitForConnections(t, numberOfClients)
 
-		wg.Wait()
+	requestHeader := authHeader(1337)
 
-		requestHeader := http.Header{}
-		requestHeader.Set("X-User-Id", "1337")
+	d := wstest.NewDialer(e)
+	c, resp, err := d.Dial("ws://whatever/messages/listen", requestHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		d := wstest.NewDialer(e)
-		c, resp, err := d.Dial("ws://whatever/messages/listen", requestHeader)
+	defer closeConnection(c)
+
+	if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
+		t.Errorf("resp.StatusCode = %q, want %q", got, want)
+	}
+
+	for i := range senderOutgoingMessages {
+		outgoingMsg := senderOutgoingMessages[i]
+
+		err = c.WriteJSON(&outgoingMsg)
 		if err != nil {
 			t.Fatal(err)
 		}
+	}
 
-		defer closeConnection(c)
+	for i := range senderExpectedIncomingMessages {
+		expectedIncomingMsg := senderExpectedIncomingMessages[i]
 
-		if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
-			t.Errorf("resp.StatusCode = %q, want %q", got, want)
+		var incomingMsg model.Message
+		err = c.ReadJSON(&incomingMsg)
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		for i := range senderOutgoingMessages {
-			outgoingMsg := senderOutgoingMessages[i]
+		if incomingMsg := stripTimestamp(t, incomingMsg); incomingMsg != expectedIncomingMsg {
+			t.Errorf("incoming message: got = %+v, want %+v", incomingMsg, expectedIncomingMsg)
+		}
+	}
 
-			err = c.WriteJSON(&outgoingMsg)
-			if err != nil {
+	done.Wait()
+}
+
+func TestSendMessageHandler(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	requestHeader := authHeader(100)
+
+	d := wstest.NewDialer(e)
+	c, _, err := d.Dial("ws://whatever/messages/listen", requestHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(c)
+	waitForConnections(t, 1)
+
+	rec := doRequest(e, http.MethodPost, "/messages", `{"type":1,"message":"announcement"}`, 1337)
+
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var created model.Message
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCreated := model.Message{
+		ID:      5,
+		Message: "announcement",
+		Type:    model.TextMessage,
+		User: model.User{
+			ID:   1337,
+			IsMe: true,
+		},
+	}
+	if created := stripTimestamp(t, created); created != expectedCreated {
+		t.Errorf("created message: got = %+v, want %+v", created, expectedCreated)
+	}
+
+	var incomingMsg model.Message
+	if err := c.ReadJSON(&incomingMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedIncoming := expectedCreated
+	expectedIncoming.User.IsMe = false
+	if incomingMsg := stripTimestamp(t, incomingMsg); incomingMsg != expectedIncoming {
+		t.Errorf("incoming message: got = %+v, want %+v", incomingMsg, expectedIncoming)
+	}
+}
+
+func TestSendMessageHandlerValidation(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	testCases := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{name: "malformed body", body: `{"type":`, wantCode: "invalid_body"},
+		{name: "unknown type", body: `{"type":0,"message":"hello"}`, wantCode: "invalid_type"},
+		{name: "retract type", body: `{"type":2,"message":"hello"}`, wantCode: "invalid_type"},
+		{name: "empty message", body: `{"type":1,"message":"  "}`, wantCode: "empty_message"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rec := doRequest(e, http.MethodPost, "/messages", tc.body, 1337)
+
+			if got, want := rec.Code, http.StatusBadRequest; got != want {
+				t.Fatalf("rec.Code = %d, want %d", got, want)
+			}
+
+			var errResp model.Error
+			if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
 				t.Fatal(err)
 			}
-		}
+			if got, want := errResp.Code, tc.wantCode; got != want {
+				t.Errorf("error code = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestListMessagesHandler(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
 
-		for i := range senderExpectedIncomingMessages {
-			expectedIncomingMsg := senderExpectedIncomingMessages[i]
+	// messages 1 to 5 are sent by user 1337 in the preceding tests
+	testCases := []struct {
+		target         string
+		userID         int
+		wantIDs        []int
+		wantNextCursor string
+	}{
+		{target: "/messages?limit=2", userID: 1337, wantIDs: []int{4, 5}, wantNextCursor: "4"},
+		{target: "/messages?before=4&limit=2", userID: 1337, wantIDs: []int{2, 3}, wantNextCursor: "2"},
+		{target: "/messages?before=2&limit=2", userID: 100, wantIDs: []int{1}},
+		{target: "/messages?after=0&limit=3", userID: 100, wantIDs: []int{1, 2, 3}, wantNextCursor: "3"},
+		{target: "/messages?after=3&limit=3", userID: 100, wantIDs: []int{4, 5}},
+		{target: "/messages?after=5", userID: 100, wantIDs: []int{}},
+		{target: "/messages", userID: 1337, wantIDs: []int{1, 2, 3, 4, 5}},
+	}
 
-			var incomingMsg model.Message
-			err = c.ReadJSON(&incomingMsg)
-			if err != nil {
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.target, func(t *testing.T) {
+			rec := doRequest(e, http.MethodGet, tc.target, "", tc.userID)
+			if got, want := rec.Code, http.StatusOK; got != want {
+				t.Fatalf("rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+			}
+
+			var page model.MessagePage
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
 				t.Fatal(err)
 			}
 
-			if incomingMsg != expectedIncomingMsg {
-				t.Errorf("incoming message: got = %+v, want %+v", incomingMsg, expectedIncomingMsg)
+			gotIDs := make([]int64, len(page.Messages))
+			for i, msg := range page.Messages {
+				gotIDs[i] = msg.ID
+				if got, want := msg.User.IsMe, msg.User.ID == tc.userID; got != want {
+					t.Errorf("message %d: User.IsMe = %t, want %t", msg.ID, got, want)
+				}
+			}
+			if fmt.Sprint(gotIDs) != fmt.Sprint(tc.wantIDs) {
+				t.Errorf("message IDs = %v, want %v", gotIDs, tc.wantIDs)
+			}
+			if got, want := page.NextCursor, tc.wantNextCursor; got != want {
+				t.Errorf("NextCursor = %q, want %q", got, want)
+			}
+		})
+	}
+
+	for _, target := range []string{"/messages?before=3&after=1", "/messages?before=x", "/messages?limit=0", "/messages?limit=101"} {
+		if got, want := doRequest(e, http.MethodGet, target, "", 100).Code, http.StatusBadRequest; got != want {
+			t.Errorf("GET %s: rec.Code = %d, want %d", target, got, want)
+		}
+	}
+}
+
+func TestRetractMessage(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	listenerHeader := authHeader(100)
+	listener, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", listenerHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(listener)
+
+	authorHeader := authHeader(1337)
+	author, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authorHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(author)
+	waitForConnections(t, 2)
+
+	expectRetraction := func(t *testing.T, messageID int64) {
+		var msg model.Message
+		if err := listener.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := model.Message{
+			ID:        messageID,
+			Type:      model.RetractMessage,
+			User:      model.User{ID: 1337},
+			Retracted: true,
+		}
+		if msg := stripTimestamp(t, msg); msg != expected {
+			t.Errorf("retraction: got = %+v, want %+v", msg, expected)
+		}
+
+		// drain the author's copy of the event
+		if err := author.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("over websocket", func(t *testing.T) {
+		err := author.WriteJSON(model.Message{ID: 1, Type: model.RetractMessage})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectRetraction(t, 1)
+	})
+
+	t.Run("over http", func(t *testing.T) {
+		rec := doRequest(e, http.MethodDelete, "/messages/2", "", 1337)
+		if got, want := rec.Code, http.StatusNoContent; got != want {
+			t.Fatalf("rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+		}
+
+		expectRetraction(t, 2)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			target   string
+			userID   int
+			wantCode int
+		}{
+			{target: "/messages/2", userID: 1337, wantCode: http.StatusConflict},
+			{target: "/messages/3", userID: 100, wantCode: http.StatusForbidden},
+			{target: "/messages/999", userID: 1337, wantCode: http.StatusNotFound},
+			{target: "/messages/x", userID: 1337, wantCode: http.StatusBadRequest},
+		}
+
+		for _, tc := range testCases {
+			rec := doRequest(e, http.MethodDelete, tc.target, "", tc.userID)
+			if got, want := rec.Code, tc.wantCode; got != want {
+				t.Errorf("DELETE %s by %d: rec.Code = %d, want %d", tc.target, tc.userID, got, want)
+			}
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		rec := doRequest(e, http.MethodGet, "/messages?after=0&limit=3", "", 100)
+
+		var page model.MessagePage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, msg := range page.Messages {
+			wantRetracted := msg.ID <= 2
+			if msg.Retracted != wantRetracted {
+				t.Errorf("message %d: Retracted = %t, want %t", msg.ID, msg.Retracted, wantRetracted)
+			}
+			if wantRetracted && msg.Message != "" {
+				t.Errorf("message %d: Message = %q, want it hidden", msg.ID, msg.Message)
+			}
+		}
+	})
+}
+
+func TestEditMessage(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	listenerHeader := authHeader(100)
+	listener, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", listenerHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(listener)
+
+	authorHeader := authHeader(1337)
+	author, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authorHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(author)
+	waitForConnections(t, 2)
+
+	expectEdit := func(t *testing.T, body string, revision int) {
+		var msg model.Message
+		if err := listener.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := model.Message{
+			ID:       3,
+			Type:     model.EditMessage,
+			Message:  body,
+			User:     model.User{ID: 1337},
+			Revision: revision,
+		}
+		if msg := stripTimestamp(t, msg); msg != expected {
+			t.Errorf("edit: got = %+v, want %+v", msg, expected)
+		}
+
+		// drain the author's copy of the event
+		if err := author.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("over http", func(t *testing.T) {
+		rec := doRequest(e, http.MethodPatch, "/messages/3", `{"message":"hello, edited"}`, 1337)
+		if got, want := rec.Code, http.StatusOK; got != want {
+			t.Fatalf("rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+		}
+
+		var edited model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &edited); err != nil {
+			t.Fatal(err)
+		}
+		if edited.Message != "hello, edited" || edited.Revision != 1 {
+			t.Errorf("edited message = %+v, want revision 1 with the new body", edited)
+		}
+
+		expectEdit(t, "hello, edited", 1)
+	})
+
+	t.Run("over websocket", func(t *testing.T) {
+		err := author.WriteJSON(model.Message{ID: 3, Type: model.EditMessage, Message: "hello, edited twice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectEdit(t, "hello, edited twice", 2)
+	})
+
+	t.Run("revisions", func(t *testing.T) {
+		rec := doRequest(e, http.MethodGet, "/messages/3/revisions", "", 100)
+		if got, want := rec.Code, http.StatusOK; got != want {
+			t.Fatalf("rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+		}
+
+		var revisions []model.MessageRevision
+		if err := json.Unmarshal(rec.Body.Bytes(), &revisions); err != nil {
+			t.Fatal(err)
+		}
+
+		wantBodies := []string{"hello", "hello, edited"}
+		if len(revisions) != len(wantBodies) {
+			t.Fatalf("got %d revisions, want %d", len(revisions), len(wantBodies))
+		}
+		for i, rev := range revisions {
+			if rev.Revision != i || rev.Message != wantBodies[i] || rev.Timestamp.IsZero() {
+				t.Errorf("revision [%d] = %+v, want revision %d with body %q", i, rev, i, wantBodies[i])
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			target   string
+			body     string
+			userID   int
+			wantCode int
+		}{
+			{target: "/messages/3", body: `{"message":" "}`, userID: 1337, wantCode: http.StatusBadRequest},
+			{target: "/messages/3", body: `{"message":"hijacked"}`, userID: 100, wantCode: http.StatusForbidden},
+			{target: "/messages/1", body: `{"message":"retracted"}`, userID: 1337, wantCode: http.StatusConflict},
+			{target: "/messages/999", body: `{"message":"missing"}`, userID: 1337, wantCode: http.StatusNotFound},
+		}
+
+		for _, tc := range testCases {
+			rec := doRequest(e, http.MethodPatch, tc.target, tc.body, tc.userID)
+			if got, want := rec.Code, tc.wantCode; got != want {
+				t.Errorf("PATCH %s by %d: rec.Code = %d, want %d", tc.target, tc.userID, got, want)
 			}
 		}
 	})
 }
+
+func TestAuthentication(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	token, err := auth.NewJWT([]byte(jwtSecret), 100, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("rejects requests without valid credentials", func(t *testing.T) {
+		forged, err := auth.NewJWT([]byte("another-secret"), 100, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expired, err := auth.NewJWT([]byte(jwtSecret), 100, time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testCases := []struct {
+			name          string
+			authorization string
+			wantCode      string
+		}{
+			{name: "missing", authorization: "", wantCode: "missing_credentials"},
+			{name: "not bearer", authorization: "Basic dXNlcjpwYXNz", wantCode: "missing_credentials"},
+			{name: "forged", authorization: "Bearer " + forged, wantCode: "invalid_credentials"},
+			{name: "expired", authorization: "Bearer " + expired, wantCode: "expired_credentials"},
+		}
+
+		for _, tc := range testCases {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/messages", nil)
+				if tc.authorization != "" {
+					req.Header.Set(echo.HeaderAuthorization, tc.authorization)
+				}
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+
+				if got, want := rec.Code, http.StatusUnauthorized; got != want {
+					t.Fatalf("rec.Code = %d, want %d", got, want)
+				}
+
+				var errResp model.Error
+				if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := errResp.Code, tc.wantCode; got != want {
+					t.Errorf("error code = %q, want %q", got, want)
+				}
+			})
+		}
+	})
+
+	t.Run("rejects websocket before upgrade", func(t *testing.T) {
+		_, resp, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", nil)
+		if err == nil {
+			t.Fatal("Dial() succeeded without credentials")
+		}
+		if got, want := resp.StatusCode, http.StatusUnauthorized; got != want {
+			t.Errorf("resp.StatusCode = %d, want %d", got, want)
+		}
+	})
+
+	t.Run("accepts websocket token in query parameter", func(t *testing.T) {
+		c, resp, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?access_token="+token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeConnection(c)
+
+		if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
+			t.Errorf("resp.StatusCode = %d, want %d", got, want)
+		}
+	})
+
+	t.Run("accepts websocket token in subprotocol", func(t *testing.T) {
+		d := wstest.NewDialer(e)
+		d.Subprotocols = []string{"access_token", token}
+		c, resp, err := d.Dial("ws://whatever/messages/listen", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeConnection(c)
+
+		if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
+			t.Errorf("resp.StatusCode = %d, want %d", got, want)
+		}
+		if got, want := c.Subprotocol(), "access_token"; got != want {
+			t.Errorf("c.Subprotocol() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestRooms(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	rec := doRequest(e, http.MethodPost, "/rooms", `{"name":"general"}`, 1337)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("create room: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var room model.Room
+	if err := json.Unmarshal(rec.Body.Bytes(), &room); err != nil {
+		t.Fatal(err)
+	}
+	if room.ID < 1 || room.Name != "general" || room.CreatedBy != 1337 {
+		t.Fatalf("created room = %+v", room)
+	}
+	roomPath := fmt.Sprintf("/rooms/%d", room.ID)
+
+	var rooms []model.Room
+	rec = doRequest(e, http.MethodGet, "/rooms", "", 100)
+	if err := json.Unmarshal(rec.Body.Bytes(), &rooms); err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 1 || rooms[0] != room {
+		t.Errorf("listed rooms = %+v, want [%+v]", rooms, room)
+	}
+
+	if got, want := doRequest(e, http.MethodPost, "/rooms", `{"name":" "}`, 1337).Code, http.StatusBadRequest; got != want {
+		t.Errorf("create room without name: rec.Code = %d, want %d", got, want)
+	}
+
+	_, resp, err := wstest.NewDialer(e).Dial("ws://whatever"+roomPath+"/messages/listen", authHeader(100))
+	if err == nil {
+		t.Fatal("non member listened to the room")
+	}
+	if got, want := resp.StatusCode, http.StatusForbidden; got != want {
+		t.Errorf("non member listen: resp.StatusCode = %d, want %d", got, want)
+	}
+
+	if got, want := doRequest(e, http.MethodPost, roomPath+"/members", "", 100).Code, http.StatusNoContent; got != want {
+		t.Fatalf("join room: rec.Code = %d, want %d", got, want)
+	}
+
+	member, _, err := wstest.NewDialer(e).Dial("ws://whatever"+roomPath+"/messages/listen", authHeader(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(member)
+
+	outsider, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(outsider)
+	waitForConnections(t, 2)
+
+	rec = doRequest(e, http.MethodPost, roomPath+"/messages", `{"type":1,"message":"room only"}`, 1337)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send room message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var roomMessage model.Message
+	if err := member.ReadJSON(&roomMessage); err != nil {
+		t.Fatal(err)
+	}
+	if roomMessage.RoomID != room.ID || roomMessage.Message != "room only" {
+		t.Errorf("member received %+v, want the room message", roomMessage)
+	}
+
+	// the outsider listens to the global room, its next message must be the global one
+	rec = doRequest(e, http.MethodPost, "/messages", `{"type":1,"message":"everyone"}`, 1337)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send global message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var globalMessage model.Message
+	if err := outsider.ReadJSON(&globalMessage); err != nil {
+		t.Fatal(err)
+	}
+	if globalMessage.RoomID != 0 || globalMessage.Message != "everyone" {
+		t.Errorf("outsider received %+v, want the global message", globalMessage)
+	}
+
+	var page model.MessagePage
+	rec = doRequest(e, http.MethodGet, roomPath+"/messages", "", 100)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].ID != roomMessage.ID {
+		t.Errorf("room history = %+v, want only message %d", page.Messages, roomMessage.ID)
+	}
+
+	rec = doRequest(e, http.MethodGet, "/messages?after="+strconv.FormatInt(roomMessage.ID-1, 10), "", 100)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].ID != globalMessage.ID {
+		t.Errorf("global history = %+v, want only message %d", page.Messages, globalMessage.ID)
+	}
+
+	testCases := []struct {
+		method   string
+		target   string
+		body     string
+		userID   int
+		wantCode int
+	}{
+		{method: http.MethodPost, target: roomPath + "/messages", body: `{"type":1,"message":"let me in"}`, userID: 200, wantCode: http.StatusForbidden},
+		{method: http.MethodGet, target: roomPath + "/messages", userID: 200, wantCode: http.StatusForbidden},
+		{method: http.MethodGet, target: "/messages/" + strconv.FormatInt(roomMessage.ID, 10) + "/revisions", userID: 200, wantCode: http.StatusForbidden},
+		{method: http.MethodGet, target: "/rooms/999/messages", userID: 100, wantCode: http.StatusNotFound},
+		{method: http.MethodPost, target: "/rooms/999/members", userID: 100, wantCode: http.StatusNotFound},
+		{method: http.MethodGet, target: "/rooms/x", userID: 100, wantCode: http.StatusBadRequest},
+		{method: http.MethodDelete, target: roomPath + "/members", userID: 100, wantCode: http.StatusNoContent},
+		{method: http.MethodGet, target: roomPath + "/messages", userID: 100, wantCode: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		rec := doRequest(e, tc.method, tc.target, tc.body, tc.userID)
+		if got, want := rec.Code, tc.wantCode; got != want {
+			t.Errorf("%s %s by %d: rec.Code = %d, want %d", tc.method, tc.target, tc.userID, got, want)
+		}
+	}
+}
+
+func TestDirectMessages(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	sender, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(sender)
+
+	recipient, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(501))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(recipient)
+
+	outsider, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(502))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(outsider)
+	waitForConnections(t, 3)
+
+	if err := sender.WriteJSON(model.Message{Type: model.TextMessage, Message: "psst", ToUserID: 501}); err != nil {
+		t.Fatal(err)
+	}
+
+	var own, received model.Message
+	if err := sender.ReadJSON(&own); err != nil {
+		t.Fatal(err)
+	}
+	if err := recipient.ReadJSON(&received); err != nil {
+		t.Fatal(err)
+	}
+	if !own.User.IsMe || own.ToUserID != 501 || own.Message != "psst" {
+		t.Errorf("sender received %+v", own)
+	}
+	if received.ID != own.ID || received.User.IsMe || received.User.ID != 500 || received.ToUserID != 501 {
+		t.Errorf("recipient received %+v, want message %d from 500", received, own.ID)
+	}
+
+	rec := doRequest(e, http.MethodPost, "/dms/500/messages", `{"type":1,"message":"hi back"}`, 501)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send direct message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var reply model.Message
+	if err := sender.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Message != "hi back" || reply.User.ID != 501 || reply.ToUserID != 500 {
+		t.Errorf("sender received reply %+v", reply)
+	}
+	if err := recipient.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+
+	// the outsider's next message must be the global one, not any of the direct messages
+	rec = doRequest(e, http.MethodPost, "/messages", `{"type":1,"message":"public"}`, 500)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send global message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var globalMessage model.Message
+	if err := outsider.ReadJSON(&globalMessage); err != nil {
+		t.Fatal(err)
+	}
+	if globalMessage.Message != "public" || globalMessage.ToUserID != 0 {
+		t.Errorf("outsider received %+v, want the global message", globalMessage)
+	}
+	for _, c := range []*websocket.Conn{sender, recipient} {
+		if err := c.ReadJSON(&globalMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var page model.MessagePage
+	rec = doRequest(e, http.MethodGet, "/dms/501/messages", "", 500)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].ID != own.ID || page.Messages[1].ID != reply.ID {
+		t.Errorf("direct history = %+v, want messages %d and %d", page.Messages, own.ID, reply.ID)
+	}
+
+	rec = doRequest(e, http.MethodGet, "/messages?after="+strconv.FormatInt(own.ID-1, 10), "", 502)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].ID != globalMessage.ID {
+		t.Errorf("global history = %+v, want only message %d", page.Messages, globalMessage.ID)
+	}
+
+	testCases := []struct {
+		method   string
+		target   string
+		body     string
+		userID   int
+		wantCode int
+	}{
+		{method: http.MethodPost, target: "/dms/500/messages", body: `{"type":1,"message":"me"}`, userID: 500, wantCode: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/dms/x/messages", body: `{"type":1,"message":"x"}`, userID: 500, wantCode: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/dms/501/messages", body: `{"type":1,"message":" "}`, userID: 500, wantCode: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/messages/" + strconv.FormatInt(own.ID, 10) + "/revisions", userID: 502, wantCode: http.StatusForbidden},
+		{method: http.MethodGet, target: "/messages/" + strconv.FormatInt(own.ID, 10) + "/revisions", userID: 501, wantCode: http.StatusOK},
+		{method: http.MethodDelete, target: "/messages/" + strconv.FormatInt(own.ID, 10), userID: 501, wantCode: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		rec := doRequest(e, tc.method, tc.target, tc.body, tc.userID)
+		if got, want := rec.Code, tc.wantCode; got != want {
+			t.Errorf("%s %s by %d: rec.Code = %d, want %d", tc.method, tc.target, tc.userID, got, want)
+		}
+	}
+
+	rec = doRequest(e, http.MethodDelete, "/messages/"+strconv.FormatInt(own.ID, 10), "", 500)
+	if got, want := rec.Code, http.StatusNoContent; got != want {
+		t.Fatalf("retract direct message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var retraction model.Message
+	if err := recipient.ReadJSON(&retraction); err != nil {
+		t.Fatal(err)
+	}
+	if retraction.Type != model.RetractMessage || retraction.ID != own.ID {
+		t.Errorf("recipient received %+v, want the retraction of %d", retraction, own.ID)
+	}
+}
+
+func TestResumeListener(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	sent := []struct {
+		target string
+		body   string
+	}{
+		{target: "/messages", body: `{"type":1,"message":"missed 1"}`},
+		{target: "/dms/600/messages", body: `{"type":1,"message":"missed direct"}`},
+		{target: "/messages", body: `{"type":1,"message":"missed 2"}`},
+	}
+
+	var missed []model.Message
+	for _, s := range sent {
+		rec := doRequest(e, http.MethodPost, s.target, s.body, 601)
+		if got, want := rec.Code, http.StatusCreated; got != want {
+			t.Fatalf("send %s: rec.Code = %d, want %d, body: %s", s.body, got, want, rec.Body)
+		}
+
+		var msg model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		msg.User.IsMe = false
+		missed = append(missed, msg)
+	}
+
+	since := strconv.FormatInt(missed[0].ID-1, 10)
+	_, resp, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?since=x", authHeader(600))
+	if err == nil {
+		t.Fatal("listened with an invalid since")
+	}
+	if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+		t.Errorf("invalid since: resp.StatusCode = %d, want %d", got, want)
+	}
+
+	c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?since="+since, authHeader(600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(c)
+	waitForConnections(t, 1)
+
+	for _, want := range missed {
+		var got model.Message
+		if err := c.ReadJSON(&got); err != nil {
+			t.Fatal(err)
+		}
+		if stripTimestamp(t, got) != stripTimestamp(t, want) {
+			t.Errorf("replayed %+v, want %+v", got, want)
+		}
+	}
+
+	rec := doRequest(e, http.MethodPost, "/messages", `{"type":1,"message":"live"}`, 601)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send live message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var live model.Message
+	if err := c.ReadJSON(&live); err != nil {
+		t.Fatal(err)
+	}
+	if live.Message != "live" || live.ID != missed[len(missed)-1].ID+1 {
+		t.Errorf("received %+v after the replay, want the live message", live)
+	}
+}
+
+func TestUserProfiles(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	if got, want := doRequest(e, http.MethodGet, "/users/700", "", 701).Code, http.StatusNotFound; got != want {
+		t.Errorf("get missing profile: rec.Code = %d, want %d", got, want)
+	}
+
+	c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(701))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(c)
+	waitForConnections(t, 1)
+
+	testCases := []struct {
+		body     string
+		userID   int
+		wantCode int
+	}{
+		{body: `{"name":"Mallory"}`, userID: 701, wantCode: http.StatusForbidden},
+		{body: `{"name":"  "}`, userID: 700, wantCode: http.StatusBadRequest},
+		{body: `{"name":"` + strings.Repeat("a", 65) + `"}`, userID: 700, wantCode: http.StatusBadRequest},
+		{body: `{"name":"Alice","avatar_url":"ftp://example.com/a.png"}`, userID: 700, wantCode: http.StatusBadRequest},
+		{body: `{"name":"Alice","avatar_url":"/a.png"}`, userID: 700, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		rec := doRequest(e, http.MethodPut, "/users/700", tc.body, tc.userID)
+		if got, want := rec.Code, tc.wantCode; got != want {
+			t.Errorf("PUT %s by %d: rec.Code = %d, want %d", tc.body, tc.userID, got, want)
+		}
+	}
+
+	rec := doRequest(e, http.MethodPut, "/users/700", `{"name":" Alice ","avatar_url":"https://example.com/a.png"}`, 700)
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("update profile: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	alice := model.User{ID: 700, Name: "Alice", AvatarURL: "https://example.com/a.png"}
+
+	var updated model.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	if want := (model.User{ID: 700, Name: "Alice", AvatarURL: "https://example.com/a.png", IsMe: true}); updated != want {
+		t.Errorf("updated profile = %+v, want %+v", updated, want)
+	}
+
+	var event model.Message
+	if err := c.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != model.UserUpdatedMessage || event.User != alice || event.Timestamp.IsZero() {
+		t.Errorf("received %+v, want the user_updated event of %+v", event, alice)
+	}
+
+	var fetched model.User
+	rec = doRequest(e, http.MethodGet, "/users/700", "", 701)
+	if err := json.Unmarshal(rec.Body.Bytes(), &fetched); err != nil {
+		t.Fatal(err)
+	}
+	if fetched != alice {
+		t.Errorf("fetched profile = %+v, want %+v", fetched, alice)
+	}
+
+	rec = doRequest(e, http.MethodPost, "/messages", `{"type":1,"message":"hi, I am Alice"}`, 700)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var received model.Message
+	if err := c.ReadJSON(&received); err != nil {
+		t.Fatal(err)
+	}
+	if received.User != alice {
+		t.Errorf("message author = %+v, want %+v", received.User, alice)
+	}
+
+	var page model.MessagePage
+	rec = doRequest(e, http.MethodGet, "/messages?after="+strconv.FormatInt(received.ID-1, 10), "", 701)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].User != alice {
+		t.Errorf("history = %+v, want the message of %+v", page.Messages, alice)
+	}
+}
+
+func TestPresence(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	_, resp, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?presence=maybe", authHeader(811))
+	if err == nil {
+		t.Fatal("listened with an invalid presence")
+	}
+	if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+		t.Errorf("invalid presence: resp.StatusCode = %d, want %d", got, want)
+	}
+
+	observer, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?presence=true", authHeader(811))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(observer)
+	events := receivePresence(observer)
+
+	if msg := readPresence(t, events, 811); msg.Status != model.OnlineStatus || !msg.User.IsMe {
+		t.Errorf("observer received %+v, want its own online event", msg)
+	}
+
+	c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(810))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := readPresence(t, events, 810); msg.Status != model.OnlineStatus || msg.Timestamp.IsZero() {
+		t.Errorf("observer received %+v, want the online event of 810", msg)
+	}
+	if online := onlineUsers(t, e); !online[810] || !online[811] {
+		t.Errorf("online users = %v, want 810 and 811", online)
+	}
+
+	// reconnecting within the grace period keeps the user online without any event
+	closeConnection(c)
+	waitForConnections(t, 1)
+	c, _, err = wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(810))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 2)
+	time.Sleep(2 * presenceGracePeriod)
+	if online := onlineUsers(t, e); !online[810] {
+		t.Errorf("online users = %v, want 810 after its reconnect", online)
+	}
+
+	closeConnection(c)
+	if msg := readPresence(t, events, 810); msg.Status != model.OfflineStatus {
+		t.Errorf("observer received %+v, want the offline event of 810", msg)
+	}
+	if online := onlineUsers(t, e); online[810] || !online[811] {
+		t.Errorf("online users = %v, want 811 without 810", online)
+	}
+}
+
+func TestTypingIndicators(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	conns := make(map[int]*websocket.Conn)
+	for _, userID := range []int{820, 821, 822} {
+		c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(userID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeConnection(c)
+		conns[userID] = c
+	}
+	waitForConnections(t, 3)
+
+	var page model.MessagePage
+	rec := doRequest(e, http.MethodGet, "/messages?limit=1", "", 820)
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	lastID := page.Messages[0].ID
+
+	if err := conns[820].WriteJSON(model.Message{Type: model.TypingMessage}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, userID := range []int{821, 822} {
+		var typing model.Message
+		if err := conns[userID].ReadJSON(&typing); err != nil {
+			t.Fatal(err)
+		}
+		if typing.Type != model.TypingMessage || typing.ID != 0 || typing.User.ID != 820 {
+			t.Errorf("%d received %+v, want the typing event of 820", userID, typing)
+		}
+		if typing.ExpiresAt == nil || !typing.ExpiresAt.After(typing.Timestamp) {
+			t.Errorf("%d received typing event expiring at %v, want after %v", userID, typing.ExpiresAt, typing.Timestamp)
+		}
+	}
+
+	if err := conns[820].WriteJSON(model.Message{Type: model.TypingMessage, ToUserID: 822}); err != nil {
+		t.Fatal(err)
+	}
+
+	var typing model.Message
+	if err := conns[822].ReadJSON(&typing); err != nil {
+		t.Fatal(err)
+	}
+	if typing.Type != model.TypingMessage || typing.User.ID != 820 || typing.ToUserID != 822 {
+		t.Errorf("822 received %+v, want the direct typing event of 820", typing)
+	}
+
+	// neither the typing user nor the users outside of the conversation hear
+	// about it, their next message must be the text message
+	rec = doRequest(e, http.MethodPost, "/messages", `{"type":1,"message":"done typing"}`, 820)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var sent model.Message
+	if err := json.Unmarshal(rec.Body.Bytes(), &sent); err != nil {
+		t.Fatal(err)
+	}
+
+	for userID, c := range conns {
+		var msg model.Message
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != model.TextMessage || msg.ID != sent.ID {
+			t.Errorf("%d received %+v, want the text message %d", userID, msg, sent.ID)
+		}
+	}
+
+	// the typing events are not stored, they take no message ID
+	if got, want := sent.ID, lastID+1; got != want {
+		t.Errorf("sent message ID = %d, want %d", got, want)
+	}
+}
+
+func TestReadReceipts(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	unreadOf := func(userID int) model.Unread {
+		t.Helper()
+
+		var unread model.Unread
+		rec := doRequest(e, http.MethodGet, "/unread", "", userID)
+		if err := json.Unmarshal(rec.Body.Bytes(), &unread); err != nil {
+			t.Fatal(err)
+		}
+		return unread
+	}
+	conversation := func(unread model.Unread, roomID int, peerID int) model.UnreadCount {
+		for _, c := range unread.Conversations {
+			if c.RoomID == roomID && c.UserID == peerID {
+				return c
+			}
+		}
+		t.Fatalf("no conversation with room %d and user %d in %+v", roomID, peerID, unread)
+		return model.UnreadCount{}
+	}
+
+	before := conversation(unreadOf(830), 0, 0)
+
+	var sent []model.Message
+	for _, s := range []struct {
+		target string
+		body   string
+	}{
+		{target: "/messages", body: `{"type":1,"message":"read me"}`},
+		{target: "/messages", body: `{"type":1,"message":"me too"}`},
+		{target: "/dms/830/messages", body: `{"type":1,"message":"and me"}`},
+	} {
+		rec := doRequest(e, http.MethodPost, s.target, s.body, 831)
+		if got, want := rec.Code, http.StatusCreated; got != want {
+			t.Fatalf("send %s: rec.Code = %d, want %d, body: %s", s.body, got, want, rec.Body)
+		}
+
+		var msg model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, msg)
+	}
+
+	unread := unreadOf(830)
+	if got, want := conversation(unread, 0, 0).Unread, before.Unread+2; got != want {
+		t.Errorf("global unread = %d, want %d", got, want)
+	}
+	if got, want := conversation(unread, 0, 831).Unread, 1; got != want {
+		t.Errorf("direct unread = %d, want %d", got, want)
+	}
+	if got, want := unread.Total, before.Unread+3; got != want {
+		t.Errorf("total unread = %d, want %d", got, want)
+	}
+
+	reader, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(830))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(reader)
+
+	author, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(831))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(author)
+	waitForConnections(t, 2)
+
+	rec := doRequest(e, http.MethodPost, "/messages/read", `{"id":`+strconv.FormatInt(sent[0].ID, 10)+`}`, 830)
+	if got, want := rec.Code, http.StatusNoContent; got != want {
+		t.Fatalf("mark read: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	for _, c := range []*websocket.Conn{reader, author} {
+		var receipt model.Message
+		if err := c.ReadJSON(&receipt); err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Type != model.ReadMessage || receipt.ID != sent[0].ID || receipt.User.ID != 830 || receipt.ToUserID != 0 {
+			t.Errorf("received %+v, want the read receipt of %d by 830", receipt, sent[0].ID)
+		}
+	}
+
+	global := conversation(unreadOf(830), 0, 0)
+	if global.Unread != 1 || global.LastReadID != sent[0].ID {
+		t.Errorf("global conversation = %+v, want 1 unread after %d", global, sent[0].ID)
+	}
+
+	// going back is ignored and sends no receipt, so the next receipt is the direct one
+	rec = doRequest(e, http.MethodPost, "/messages/read", `{"id":`+strconv.FormatInt(sent[0].ID-1, 10)+`}`, 830)
+	if got, want := rec.Code, http.StatusNoContent; got != want {
+		t.Fatalf("mark read backwards: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	if err := reader.WriteJSON(model.Message{Type: model.ReadMessage, ID: sent[2].ID, ToUserID: 831}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*websocket.Conn{reader, author} {
+		var receipt model.Message
+		if err := c.ReadJSON(&receipt); err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Type != model.ReadMessage || receipt.ID != sent[2].ID || receipt.ToUserID != 831 {
+			t.Errorf("received %+v, want the read receipt of the direct message %d", receipt, sent[2].ID)
+		}
+	}
+
+	unread = unreadOf(830)
+	if got, want := conversation(unread, 0, 831).Unread, 0; got != want {
+		t.Errorf("direct unread = %d, want %d", got, want)
+	}
+	if got, want := unread.Total, 1; got != want {
+		t.Errorf("total unread = %d, want %d", got, want)
+	}
+
+	testCases := []struct {
+		target   string
+		body     string
+		wantCode int
+	}{
+		{target: "/messages/read", body: `{"id":0}`, wantCode: http.StatusBadRequest},
+		{target: "/messages/read", body: `{"id":` + strconv.FormatInt(sent[2].ID, 10) + `}`, wantCode: http.StatusNotFound},
+		{target: "/messages/read", body: `{"id":999999}`, wantCode: http.StatusNotFound},
+		{target: "/dms/832/messages/read", body: `{"id":` + strconv.FormatInt(sent[2].ID, 10) + `}`, wantCode: http.StatusNotFound},
+		{target: "/dms/830/messages/read", body: `{"id":` + strconv.FormatInt(sent[2].ID, 10) + `}`, wantCode: http.StatusBadRequest},
+		{target: "/rooms/999/messages/read", body: `{"id":` + strconv.FormatInt(sent[0].ID, 10) + `}`, wantCode: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		rec := doRequest(e, http.MethodPost, tc.target, tc.body, 830)
+		if got, want := rec.Code, tc.wantCode; got != want {
+			t.Errorf("POST %s %s: rec.Code = %d, want %d", tc.target, tc.body, got, want)
+		}
+	}
+}
+
+func TestDeliveryAcks(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	if _, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?ack=maybe", authHeader(840)); err == nil {
+		t.Fatal("listened with an invalid ack")
+	}
+
+	connectionOf := func(userID int) model.ConnectionStatus {
+		t.Helper()
+
+		var statuses []model.ConnectionStatus
+		rec := doRequest(e, http.MethodGet, "/connections", "", userID)
+		if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) != 1 {
+			t.Fatalf("connections of %d = %+v, want one", userID, statuses)
+		}
+		return statuses[0]
+	}
+	waitForStatus := func(userID int, done func(model.ConnectionStatus) bool) model.ConnectionStatus {
+		t.Helper()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			status := connectionOf(userID)
+			if done(status) {
+				return status
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the connection status, last %+v", status)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	send := func(body string) model.Message {
+		t.Helper()
+
+		rec := doRequest(e, http.MethodPost, "/dms/840/messages", body, 841)
+		if got, want := rec.Code, http.StatusCreated; got != want {
+			t.Fatalf("send %s: rec.Code = %d, want %d, body: %s", body, got, want, rec.Body)
+		}
+
+		var msg model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?ack=true", authHeader(840))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 1)
+
+	acked := send(`{"type":1,"message":"ack me"}`)
+	var msg model.Message
+	if err := c.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != acked.ID {
+		t.Fatalf("received %+v, want %d", msg, acked.ID)
+	}
+	if err := c.WriteJSON(model.Message{Type: model.AckMessage, ID: msg.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	status := waitForStatus(840, func(s model.ConnectionStatus) bool { return s.Acked == 1 })
+	if !status.Ack || status.Pending != 0 || status.Retried != 0 || status.Dispatched != 1 {
+		t.Errorf("status after the ack = %+v", status)
+	}
+
+	// the original delivery and every retry carry the same message until it expires
+	unacked := send(`{"type":1,"message":"ignore me"}`)
+	for i := 0; i <= maxDeliveryRetries; i++ {
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID != unacked.ID || msg.Message != unacked.Message {
+			t.Fatalf("delivery %d: received %+v, want %d", i, msg, unacked.ID)
+		}
+	}
+
+	status = waitForStatus(840, func(s model.ConnectionStatus) bool { return s.Expired == 1 })
+	if status.Pending != 0 || status.Retried != maxDeliveryRetries || status.Acked != 1 {
+		t.Errorf("status after the expiry = %+v", status)
+	}
+
+	if err := closeConnection(c); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 0)
+
+	// a connection which does not ack leaves the offline queue alone
+	c, _, err = wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(840))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 1)
+	if status := connectionOf(840); status.Dispatched != 0 {
+		t.Errorf("status of the connection without acks = %+v, want nothing dispatched", status)
+	}
+	if err := closeConnection(c); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 0)
+
+	// the expired message waits in the offline queue for the next connection
+	c, _, err = wstest.NewDialer(e).Dial("ws://whatever/messages/listen?ack=true", authHeader(840))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(c)
+
+	if err := c.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != unacked.ID || msg.Message != unacked.Message {
+		t.Fatalf("received %+v, want the queued message %d", msg, unacked.ID)
+	}
+	if err := c.WriteJSON(model.Message{Type: model.AckMessage, ID: msg.ID}); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(840, func(s model.ConnectionStatus) bool { return s.Acked == 1 && s.Pending == 0 })
+}
+
+func TestResumeInAckMode(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	var missed []model.Message
+	for _, body := range []string{`{"type":1,"message":"replayed, acked"}`, `{"type":1,"message":"replayed, ignored"}`} {
+		rec := doRequest(e, http.MethodPost, "/dms/897/messages", body, 898)
+		if got, want := rec.Code, http.StatusCreated; got != want {
+			t.Fatalf("send %s: rec.Code = %d, want %d, body: %s", body, got, want, rec.Body)
+		}
+
+		var msg model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		missed = append(missed, msg)
+	}
+
+	since := strconv.FormatInt(missed[0].ID-1, 10)
+	c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?ack=true&since="+since, authHeader(897))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(c)
+	waitForConnections(t, 1)
+
+	// the replayed messages are tracked like the live ones: the ignored one is
+	// delivered again until it is acknowledged
+	var msg model.Message
+	for i, want := range []int64{missed[0].ID, missed[1].ID, missed[1].ID} {
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID != want {
+			t.Fatalf("delivery %d: received %+v, want %d", i, msg, want)
+		}
+		if i == 0 {
+			if err := c.WriteJSON(model.Message{Type: model.AckMessage, ID: msg.ID}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := c.WriteJSON(model.Message{Type: model.AckMessage, ID: msg.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var statuses []model.ConnectionStatus
+		rec := doRequest(e, http.MethodGet, "/connections", "", 897)
+		if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) != 1 {
+			t.Fatalf("connections = %+v, want one", statuses)
+		}
+		if s := statuses[0]; s.Acked == 2 && s.Pending == 0 {
+			if s.Retried == 0 || s.Expired != 0 {
+				t.Errorf("status after the acks = %+v", s)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the acks, last %+v", statuses[0])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResumeBeyondSendQueue(t *testing.T) {
+	const queueSize, numOfMissed = 4, 50
+
+	h := hs
+	h.SendQueue = chatWebsocket.QueueOptions{Size: queueSize, Overflow: chatWebsocket.Disconnect}
+	e := echo.New()
+	_ = server.New(e, "", h, authenticator)
+
+	waitForConnections(t, 0)
+
+	var missed []int64
+	for i := 0; i < numOfMissed; i++ {
+		rec := doRequest(e, http.MethodPost, "/dms/899/messages", `{"type":1,"message":"missed `+strconv.Itoa(i)+`"}`, 900)
+		if got, want := rec.Code, http.StatusCreated; got != want {
+			t.Fatalf("send %d: rec.Code = %d, want %d, body: %s", i, got, want, rec.Body)
+		}
+
+		var msg model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		missed = append(missed, msg.ID)
+	}
+
+	since := strconv.FormatInt(missed[0]-1, 10)
+	c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?since="+since, authHeader(899))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConnection(c)
+	waitForConnections(t, 1)
+
+	// the replay waits for the queue instead of overflowing it
+	for i, want := range missed {
+		var msg model.Message
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatalf("replay %d: %v", i, err)
+		}
+		if msg.ID != want {
+			t.Fatalf("replay %d: received %+v, want %d", i, msg, want)
+		}
+	}
+
+	rec := doRequest(e, http.MethodPost, "/dms/899/messages", `{"type":1,"message":"live"}`, 900)
+	if got, want := rec.Code, http.StatusCreated; got != want {
+		t.Fatalf("send live message: rec.Code = %d, want %d, body: %s", got, want, rec.Body)
+	}
+
+	var live model.Message
+	if err := c.ReadJSON(&live); err != nil {
+		t.Fatal(err)
+	}
+	if live.Message != "live" {
+		t.Errorf("received %+v after the replay, want the live message", live)
+	}
+
+	var statuses []model.ConnectionStatus
+	rec = doRequest(e, http.MethodGet, "/connections", "", 899)
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Dropped != 0 {
+		t.Errorf("connections = %+v, want one without drops", statuses)
+	}
+}
+
+func TestInterruptedOfflineFlush(t *testing.T) {
+	const numOfQueued = 10
+
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	waitForConnections(t, 0)
+
+	listen := func(e *echo.Echo) *websocket.Conn {
+		t.Helper()
+
+		c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?ack=true", authHeader(901))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// the messages left unacknowledged by the first connection are queued for the next one
+	c := listen(e)
+	waitForConnections(t, 1)
+
+	var queued []int64
+	for i := 0; i < numOfQueued; i++ {
+		rec := doRequest(e, http.MethodPost, "/dms/901/messages", `{"type":1,"message":"queued `+strconv.Itoa(i)+`"}`, 902)
+		if got, want := rec.Code, http.StatusCreated; got != want {
+			t.Fatalf("send %d: rec.Code = %d, want %d, body: %s", i, got, want, rec.Body)
+		}
+
+		var msg model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		queued = append(queued, msg.ID)
+	}
+
+	// the retries may interleave with the first deliveries
+	received := make(map[int64]bool)
+	for len(received) < numOfQueued {
+		var msg model.Message
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		received[msg.ID] = true
+	}
+	if err := closeConnection(c); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 0)
+
+	// the socket is closed while the flush still waits for the small send queue
+	h := hs
+	h.SendQueue = chatWebsocket.QueueOptions{Size: 1}
+	interrupted := echo.New()
+	_ = server.New(interrupted, "", h, authenticator)
+
+	c = listen(interrupted)
+	var msg model.Message
+	if err := c.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != queued[0] {
+		t.Fatalf("received %+v, want the first queued message %d", msg, queued[0])
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 0)
+
+	// nothing is lost, and the order is kept
+	c = listen(e)
+	defer closeConnection(c)
+
+	for i, want := range queued {
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatalf("flush %d: %v", i, err)
+		}
+		if msg.ID != want {
+			t.Fatalf("flush %d: received %+v, want %d", i, msg, want)
+		}
+		if err := c.WriteJSON(model.Message{Type: model.AckMessage, ID: msg.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSlowConsumers(t *testing.T) {
+	const sent = 6
+
+	sendDirectMessages := func(t *testing.T, e *echo.Echo) []model.Message {
+		t.Helper()
+
+		messages := make([]model.Message, sent)
+		for i := range messages {
+			rec := doRequest(e, http.MethodPost, "/dms/850/messages", `{"type":1,"message":"slow `+strconv.Itoa(i)+`"}`, 851)
+			if got, want := rec.Code, http.StatusCreated; got != want {
+				t.Fatalf("send %d: rec.Code = %d, want %d, body: %s", i, got, want, rec.Body)
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &messages[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return messages
+	}
+
+	for _, policy := range []chatWebsocket.OverflowPolicy{chatWebsocket.DropNewest, chatWebsocket.DropOldest} {
+		t.Run(string(policy), func(t *testing.T) {
+			h := hs
+			h.SendQueue = chatWebsocket.QueueOptions{Size: 2, Overflow: policy}
+			e := echo.New()
+			_ = server.New(e, "", h, authenticator)
+
+			waitForConnections(t, 0)
+
+			c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(850))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeConnection(c)
+			waitForConnections(t, 1)
+
+			// nothing is read meanwhile, so the dispatcher holds at most one message
+			// besides the queued ones
+			messages := sendDirectMessages(t, e)
+
+			var statuses []model.ConnectionStatus
+			rec := doRequest(e, http.MethodGet, "/connections", "", 850)
+			if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+				t.Fatal(err)
+			}
+			if len(statuses) != 1 {
+				t.Fatalf("connections = %+v, want one", statuses)
+			}
+			status := statuses[0]
+			received := sent - int(status.Dropped)
+			if received < 2 || received > 3 || status.Dispatched != sent {
+				t.Fatalf("status = %+v, want 3 or 4 of %d dropped", status, sent)
+			}
+
+			ids := make([]int64, received)
+			for i := range ids {
+				var msg model.Message
+				if err := c.ReadJSON(&msg); err != nil {
+					t.Fatal(err)
+				}
+				ids[i] = msg.ID
+			}
+
+			switch policy {
+			case chatWebsocket.DropNewest:
+				for i, id := range ids {
+					if id != messages[i].ID {
+						t.Errorf("received %v, want the first %d messages", ids, received)
+						break
+					}
+				}
+			case chatWebsocket.DropOldest:
+				if ids[received-2] != messages[sent-2].ID || ids[received-1] != messages[sent-1].ID {
+					t.Errorf("received %v, want the last 2 messages at the end", ids)
+				}
+			}
+		})
+	}
+
+	t.Run(string(chatWebsocket.Disconnect), func(t *testing.T) {
+		h := hs
+		h.SendQueue = chatWebsocket.QueueOptions{Size: 1, Overflow: chatWebsocket.Disconnect}
+		e := echo.New()
+		_ = server.New(e, "", h, authenticator)
+
+		waitForConnections(t, 0)
+		before := hs.WebsocketGateway.DispatchTotals()
+
+		c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(850))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		waitForConnections(t, 1)
+
+		sendDirectMessages(t, e)
+
+		for {
+			var msg model.Message
+			err := c.ReadJSON(&msg)
+			if err == nil {
+				continue
+			}
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("read error = %v, want close %d", err, websocket.ClosePolicyViolation)
+			}
+			break
+		}
+		waitForConnections(t, 0)
+
+		after := hs.WebsocketGateway.DispatchTotals()
+		if got, want := after.Disconnected, before.Disconnected+1; got != want {
+			t.Errorf("disconnected = %d, want %d", got, want)
+		}
+		if after.Dropped <= before.Dropped {
+			t.Errorf("dropped = %d, want more than %d", after.Dropped, before.Dropped)
+		}
+	})
+}
+
+func TestHeartbeat(t *testing.T) {
+	heartbeat := chatWebsocket.HeartbeatOptions{PingInterval: 20 * time.Millisecond, PongTimeout: 30 * time.Millisecond}
+
+	t.Run("server drops the peers which stop answering", func(t *testing.T) {
+		h := hs
+		h.Heartbeat = heartbeat
+		e := echo.New()
+		_ = server.New(e, "", h, authenticator)
+
+		waitForConnections(t, 0)
+
+		var pings int32
+		alive, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(860))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeConnection(alive)
+		alive.SetPingHandler(func(appData string) error {
+			atomic.AddInt32(&pings, 1)
+			return alive.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		})
+
+		dead, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen", authHeader(861))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dead.Close()
+		dead.SetPingHandler(func(string) error { return nil })
+
+		// the control frames are only handled while reading
+		for _, c := range []*websocket.Conn{alive, dead} {
+			go func(c *websocket.Conn) {
+				for {
+					if _, _, err := c.NextReader(); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+
+		waitForConnections(t, 1)
+		time.Sleep(5 * heartbeat.PingInterval)
+
+		if got, want := hs.WebsocketGateway.TotalConnections(), 1; got != want {
+			t.Fatalf("TotalConnections() = %d, want %d", got, want)
+		}
+		if got := len(hs.WebsocketGateway.DeliveryStatus(860)); got != 1 {
+			t.Errorf("connections of the answering peer = %d, want 1", got)
+		}
+		if got := atomic.LoadInt32(&pings); got < 3 {
+			t.Errorf("pings = %d, want at least 3", got)
+		}
+	})
+
+	t.Run("client detects a silent server", func(t *testing.T) {
+		for _, tc := range []struct {
+			name       string
+			heartbeat  chatWebsocket.HeartbeatOptions
+			wantSilent bool
+		}{
+			{name: "pinging", heartbeat: heartbeat},
+			{name: "silent", wantSilent: true},
+		} {
+			h := hs
+			h.Heartbeat = tc.heartbeat
+			e := echo.New()
+			_ = server.New(e, "", h, authenticator)
+			s := httptest.NewServer(e)
+
+			waitForConnections(t, 0)
+
+			client := wsclient.NewClientOptions(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http")+"/messages/listen", authHeader(862), wsclient.Options{
+				IdleTimeout: 100 * time.Millisecond,
+			})
+			errs, err := client.Listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case err := <-errs:
+				if !tc.wantSilent || !errors.Is(err, wsclient.ErrServerSilent) {
+					t.Errorf("%s: listen error = %v", tc.name, err)
+				}
+			case <-time.After(300 * time.Millisecond):
+				if tc.wantSilent {
+					t.Errorf("%s: the silent server went unnoticed", tc.name)
+				}
+			}
+
+			client.Stop(time.Second)
+			waitForConnections(t, 0)
+			s.Close()
+		}
+	})
+}
+
+// trackingListener remembers the accepted connections so that a test can cut them
+type trackingListener struct {
+	net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *trackingListener) cut() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+func TestClientReconnect(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+	s := httptest.NewUnstartedServer(e)
+	listener := &trackingListener{Listener: s.Listener}
+	s.Listener = listener
+	s.Start()
+	defer s.Close()
+
+	waitForConnections(t, 0)
+
+	client := wsclient.NewClientOptions(context.Background(), "ws"+strings.TrimPrefix(s.URL, "http")+"/messages/listen", authHeader(870), wsclient.Options{
+		Reconnect: &wsclient.ReconnectPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     200 * time.Millisecond,
+			Jitter:         0.2,
+		},
+	})
+
+	states := make(chan wsclient.State, 20)
+	client.AttachStateObserver(func(state wsclient.State, err error) {
+		states <- state
+	})
+	messages := make(chan model.Message, 20)
+	client.AttachObserver(func(_ int, packet []byte) {
+		var msg model.Message
+		if err := json.Unmarshal(packet, &msg); err == nil && msg.Type == model.TextMessage {
+			messages <- msg
+		}
+	})
+	expectState := func(want wsclient.State) {
+		t.Helper()
+
+		select {
+		case got := <-states:
+			if got != want {
+				t.Fatalf("state = %s, want %s", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for the %s state", want)
+		}
+	}
+	expectMessage := func(want model.Message) {
+		t.Helper()
+
+		select {
+		case got := <-messages:
+			if got.ID != want.ID {
+				t.Fatalf("received %+v, want %d", got, want.ID)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for message %d", want.ID)
+		}
+	}
+	send := func(body string) model.Message {
+		t.Helper()
+
+		rec := doRequest(e, http.MethodPost, "/dms/870/messages", body, 871)
+		if got, want := rec.Code, http.StatusCreated; got != want {
+			t.Fatalf("send %s: rec.Code = %d, want %d, body: %s", body, got, want, rec.Body)
+		}
+
+		var msg model.Message
+		if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	errs, err := client.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop(time.Second)
+	expectState(wsclient.Connecting)
+	expectState(wsclient.Connected)
+	waitForConnections(t, 1)
+
+	seen := send(`{"type":1,"message":"before the cut"}`)
+	expectMessage(seen)
+	if got := client.LastSeenID(); got != seen.ID {
+		t.Errorf("LastSeenID() = %d, want %d", got, seen.ID)
+	}
+
+	// the message sent while the client is away is replayed from the last seen one
+	listener.cut()
+	expectState(wsclient.Disconnected)
+	waitForConnections(t, 0)
+	missed := send(`{"type":1,"message":"while away"}`)
+
+	expectState(wsclient.Connecting)
+	expectState(wsclient.Connected)
+	expectMessage(missed)
+
+	select {
+	case msg := <-messages:
+		t.Errorf("received %+v again", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the policy gives up once the server is gone
+	s.Listener.Close()
+	listener.cut()
+	expectState(wsclient.Disconnected)
+	for i := 0; i < 3; i++ {
+		expectState(wsclient.Connecting)
+		expectState(wsclient.Disconnected)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, wsclient.ErrReconnectFailed) {
+			t.Errorf("listen error = %v, want %v", err, wsclient.ErrReconnectFailed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the reconnect to give up")
+	}
+}
+
+func TestClientSend(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	waitForConnections(t, 0)
+
+	uri := "ws" + strings.TrimPrefix(s.URL, "http") + "/messages/listen"
+	sender := wsclient.NewClient(uri, authHeader(880))
+	if err := sender.SendText("too early"); err != wsclient.ErrNotConnected {
+		t.Errorf("SendText before Listen = %v, want %v", err, wsclient.ErrNotConnected)
+	}
+
+	receiver := wsclient.NewClient(uri, authHeader(881))
+	received := make(chan model.Message, 20)
+	receiver.AttachMessageObserver(func(msg model.Message) {
+		received <- msg
+	})
+	typing := make(chan model.Message, 1)
+	receiver.AttachMessageTypeObserver(model.TypingMessage, func(msg model.Message) {
+		typing <- msg
+	})
+
+	for _, c := range []*wsclient.Client{sender, receiver} {
+		if _, err := c.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Stop(time.Second)
+	}
+	waitForConnections(t, 2)
+
+	receive := func() model.Message {
+		t.Helper()
+
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a message")
+			return model.Message{}
+		}
+	}
+
+	// the sends of several goroutines share the connection
+	const concurrent = 5
+	var wg sync.WaitGroup
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := sender.SendText("hello " + strconv.Itoa(i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var last model.Message
+	for i := 0; i < concurrent; i++ {
+		msg := receive()
+		if msg.Type != model.TextMessage || msg.User.ID != 880 || !strings.HasPrefix(msg.Message, "hello ") {
+			t.Errorf("received %+v, want a text message of 880", msg)
+		}
+		if msg.ID <= last.ID {
+			t.Errorf("received %d after %d, want ascending IDs", msg.ID, last.ID)
+		}
+		last = msg
+	}
+
+	if err := sender.Edit(last.ID, "edited"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(); msg.Type != model.EditMessage || msg.ID != last.ID || msg.Message != "edited" {
+		t.Errorf("received %+v, want the edit of %d", msg, last.ID)
+	}
+
+	if err := sender.Retract(last.ID); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(); msg.Type != model.RetractMessage || msg.ID != last.ID {
+		t.Errorf("received %+v, want the retraction of %d", msg, last.ID)
+	}
+
+	if err := sender.SendDirectMessage(881, "psst"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(); msg.Type != model.TextMessage || msg.ToUserID != 881 || msg.Message != "psst" {
+		t.Errorf("received %+v, want the direct message", msg)
+	}
+
+	if err := sender.SendTyping(881); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-typing:
+		if msg.User.ID != 880 || msg.ToUserID != 881 {
+			t.Errorf("received %+v, want the typing event of 880", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the typing event")
+	}
+	if msg := receive(); msg.Type != model.TypingMessage {
+		t.Errorf("received %+v, want the typing event", msg)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	waitForConnections(t, 0)
+
+	scrape := func() string {
+		t.Helper()
+
+		// Prometheus scrapes without credentials
+		resp, err := http.Get(s.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /metrics = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+			t.Errorf("Content-Type = %q, want the Prometheus text format", got)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	uri := "ws" + strings.TrimPrefix(s.URL, "http") + "/messages/listen"
+	client := wsclient.NewClient(uri, authHeader(890))
+	received := make(chan model.Message, 1)
+	client.AttachMessageTypeObserver(model.TextMessage, func(msg model.Message) {
+		received <- msg
+	})
+	if _, err := client.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 1)
+
+	if err := client.SendText("measured"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+
+	out := scrape()
+	for _, want := range []string{
+		"chat_connections_active 1\n",
+		"chat_users_connected 1\n",
+		"chat_messages_received_total{type=\"text\"} ",
+		"chat_messages_delivered_total{type=\"text\"} ",
+		"chat_dispatch_queue_depth ",
+		"chat_write_duration_seconds_count ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics miss %q:\n%s", want, out)
+		}
+	}
+
+	// the connections by user are for the administrators only
+	if rec := doRequest(e, http.MethodGet, "/admin/connections", "", 890); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /admin/connections by a user = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	rec := doRequest(e, http.MethodGet, "/admin/connections", "", adminUserID)
+	var connections []model.UserConnections
+	if err := json.Unmarshal(rec.Body.Bytes(), &connections); err != nil {
+		t.Fatal(err)
+	}
+	if want := (model.UserConnections{UserID: 890, Connections: 1}); len(connections) != 1 || connections[0] != want {
+		t.Errorf("GET /admin/connections = %+v, want only %+v", connections, want)
+	}
+
+	client.Stop(time.Second)
+	waitForConnections(t, 0)
+
+	out = scrape()
+	if strings.Contains(out, "user_id=") {
+		t.Errorf("metrics report the connections by user:\n%s", out)
+	}
+	// the previous scrape is observed once it completed
+	if want := "chat_http_request_duration_seconds_count{method=\"GET\",route=\"/metrics\",status=\"200\"} "; !strings.Contains(out, want) {
+		t.Errorf("metrics miss %q:\n%s", want, out)
+	}
+
+	// an ack mode connection retries the message it does not acknowledge, which
+	// is still delivered once
+	delivered := func() int {
+		t.Helper()
+
+		const prefix = `chat_messages_delivered_total{type="text"} `
+		for _, line := range strings.Split(scrape(), "\n") {
+			if strings.HasPrefix(line, prefix) {
+				n, err := strconv.Atoi(strings.TrimPrefix(line, prefix))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return n
+			}
+		}
+		t.Fatalf("metrics miss %q", prefix)
+		return 0
+	}
+	before := delivered()
+
+	c, _, err := wstest.NewDialer(e).Dial("ws://whatever/messages/listen?ack=true", authHeader(903))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 1)
+	if rec := doRequest(e, http.MethodPost, "/dms/903/messages", `{"type":1,"message":"retried"}`, 904); rec.Code != http.StatusCreated {
+		t.Fatalf("send: rec.Code = %d, want %d, body: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var msg model.Message
+	for i := 0; i <= maxDeliveryRetries; i++ {
+		if err := c.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// acknowledged before it expires, so that it is not queued for the next run
+	if err := c.WriteJSON(model.Message{Type: model.AckMessage, ID: msg.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := closeConnection(c); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnections(t, 0)
+
+	if got := delivered() - before; got != 1 {
+		t.Errorf("chat_messages_delivered_total grew by %d for a retried message, want 1", got)
+	}
+
+	// a plain GET on the listener fails the websocket handshake
+	req, _ := http.NewRequest(http.MethodGet, uri, nil)
+	req.URL.Scheme = "http"
+	req.Header = authHeader(890)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if out := scrape(); strings.Contains(out, "chat_websocket_upgrade_failures_total 0\n") {
+		t.Errorf("metrics miss the failed upgrade:\n%s", out)
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+	defer func() {
+		hs.Logger.Levels().SetDefault(logger.DebugLevel)
+		hs.Logger.Levels().ResetLevel("gateway")
+	}()
+
+	decode := func(rec *httptest.ResponseRecorder) model.LogLevels {
+		t.Helper()
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		var levels model.LogLevels
+		if err := json.Unmarshal(rec.Body.Bytes(), &levels); err != nil {
+			t.Fatal(err)
+		}
+		return levels
+	}
+
+	levels := decode(doRequest(e, http.MethodPut, "/admin/log-levels", `{"component": "gateway", "level": "warn"}`, adminUserID))
+	if got := levels.Components["gateway"]; got != "WARN" {
+		t.Errorf("gateway level = %q, want WARN", got)
+	}
+	if hs.Logger.Component("gateway").Enabled(logger.InfoLevel) {
+		t.Error("the gateway still logs INFO entries after its level was raised to WARN")
+	}
+	if !hs.Logger.Component("websocket").Enabled(logger.DebugLevel) {
+		t.Error("the other components do not log at the default level anymore")
+	}
+
+	levels = decode(doRequest(e, http.MethodPut, "/admin/log-levels", `{"level": "ERROR"}`, adminUserID))
+	if levels.Default != "ERROR" {
+		t.Errorf("default level = %q, want ERROR", levels.Default)
+	}
+
+	levels = decode(doRequest(e, http.MethodPut, "/admin/log-levels", `{"component": "gateway"}`, adminUserID))
+	if _, ok := levels.Components["gateway"]; ok {
+		t.Errorf("gateway level %q was not reset", levels.Components["gateway"])
+	}
+
+	levels = decode(doRequest(e, http.MethodGet, "/admin/log-levels", "", adminUserID))
+	if levels.Default != "ERROR" || len(levels.Components) != 0 {
+		t.Errorf("GET /admin/log-levels = %+v, want ERROR without components", levels)
+	}
+
+	if rec := doRequest(e, http.MethodPut, "/admin/log-levels", `{"level": "LOUD"}`, adminUserID); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown level got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		if rec := doRequest(e, method, "/admin/log-levels", `{"level": "DEBUG"}`, 892); rec.Code != http.StatusForbidden {
+			t.Errorf("%s by a user who is not an administrator got status %d, want %d", method, rec.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	e := echo.New()
+	_ = server.New(e, "", hs, authenticator)
+
+	rec := doRequest(e, http.MethodGet, "/presence", "", 893)
+	generated := rec.Header().Get(echo.HeaderXRequestID)
+	if generated == "" {
+		t.Fatal("the response has no request ID")
+	}
+	if again := doRequest(e, http.MethodGet, "/presence", "", 893).Header().Get(echo.HeaderXRequestID); again == generated {
+		t.Errorf("two requests got the same ID %q", again)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/presence", nil)
+	req.Header = authHeader(893)
+	req.Header.Set(echo.HeaderXRequestID, "from-the-proxy")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(echo.HeaderXRequestID); got != "from-the-proxy" {
+		t.Errorf("request ID = %q, want the one of the client", got)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	// draining is for good, so the test has a gateway of its own
+	d, err := deps.BuildDependencies(deps.Config{
+		Auth:      deps.JWTAuth,
+		JWTSecret: jwtSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	h := hs
+	h.WebsocketGateway = d.WebsocketGateway
+	h.ChatService = d.ChatService
+	h.RoomService = d.RoomService
+	h.UserService = d.UserService
+
+	e := echo.New()
+	_ = server.New(e, "", h, authenticator)
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	check := func(path string, wantStatus int, want string) {
+		t.Helper()
+
+		// the load balancer checks without credentials
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var health model.Health
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != wantStatus || health.Status != want {
+			t.Errorf("GET %s = %d %q, want %d %q", path, resp.StatusCode, health.Status, wantStatus, want)
+		}
+	}
+	check("/healthz", http.StatusOK, model.HealthOK)
+	check("/readyz", http.StatusOK, model.HealthReady)
+
+	uri := "ws" + strings.TrimPrefix(s.URL, "http") + "/messages/listen"
+	reader, _, err := websocket.DefaultDialer.Dial(uri, authHeader(894))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	// the silent client never reads, so it never answers the close frame
+	silent, _, err := websocket.DefaultDialer.Dial(uri, authHeader(895))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := reader.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.WebsocketGateway.TotalConnections() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the connections")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if d.WebsocketGateway.Drain(200 * time.Millisecond) {
+		t.Error("Drain() = true while the silent client keeps its connection")
+	}
+
+	select {
+	case err := <-closed:
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok || closeErr.Code != websocket.CloseGoingAway || closeErr.Text != chatWebsocket.ReconnectHint {
+			t.Errorf("reader got %v, want close %d with %q", err, websocket.CloseGoingAway, chatWebsocket.ReconnectHint)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the close frame")
+	}
+	if n := d.WebsocketGateway.TotalConnections(); n != 1 {
+		t.Errorf("TotalConnections() = %d after the drain, want the silent one only", n)
+	}
+
+	check("/healthz", http.StatusOK, model.HealthOK)
+	check("/readyz", http.StatusServiceUnavailable, model.HealthDraining)
+
+	_, resp, err := websocket.DefaultDialer.Dial(uri, authHeader(896))
+	if err == nil {
+		t.Fatal("a new connection was accepted while draining")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("new connection got %v, want status %d", resp, http.StatusServiceUnavailable)
+	}
+
+	silent.Close()
+	if !d.WebsocketGateway.Drain(2 * time.Second) {
+		t.Errorf("Drain() = false, %d connections left", d.WebsocketGateway.TotalConnections())
+	}
+}
@@ -2,9 +2,13 @@ package websocket
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	gorillaWebsocket "github.com/gorilla/websocket"
+
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/metrics"
 )
 
 // Connection wraps the websocket.Conn with mutex and satisfies the ConnectionDispatcher interface
@@ -14,30 +18,175 @@ type Connection struct {
 	messageQueue    chan interface{}
 	stopSignal      chan struct{}
 	workerIsRunning bool
+	// stopped is closed once the dispatcher has exited
+	stopped chan struct{}
+
+	// queueMu serializes the producers so that the overflow policy sees a consistent queue
+	queueMu      sync.Mutex
+	queueSize    int
+	overflow     OverflowPolicy
+	disconnected bool
+	closing      bool
+	// writeFailed is set once a write fails, the websocket being unusable afterwards
+	writeFailed bool
+
+	heartbeat HeartbeatOptions
+	metrics   metrics.Metrics
+	log       logger.Logger
+
+	dispatched  uint64
+	written     uint64
+	writeErrors uint64
+	dropped     uint64
 }
 
-// NewConnectionDispatcher returns Connection and do the necessary initializations
-func NewConnectionDispatcher(conn *gorillaWebsocket.Conn) ConnectionDispatcher {
+// NewConnectionDispatcher returns Connection and do the necessary initializations.
+// The entries of l are logged as the websocket component with the remote address.
+func NewConnectionDispatcher(conn *gorillaWebsocket.Conn, queue QueueOptions, heartbeat HeartbeatOptions, m metrics.Metrics, l logger.Logger) ConnectionDispatcher {
 	c := &Connection{
-		conn: conn,
+		conn:      conn,
+		queueSize: queue.Size,
+		overflow:  queue.Overflow,
+		heartbeat: heartbeat,
+		metrics:   m,
+		log:       l.Component("websocket").With(logger.Fields{"remote": conn.RemoteAddr().String()}),
 	}
 	c.initQueue()
 
 	return c
 }
 
-// Dispatch pushes message into internal message queue to be sent by the dispatcher
+// Dispatch pushes message into internal message queue to be sent by the dispatcher.
+// It never blocks: when the queue is full, the overflow policy decides which
+// message is dropped or whether the connection is closed.
 func (c *Connection) Dispatch(msg interface{}) {
-	c.messageQueue <- msg
+	atomic.AddUint64(&c.dispatched, 1)
+
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	// msg counts as queued before the dispatcher may take it, until it is dropped
+	c.metrics.QueueDepthChanged(1)
+
+	if c.disconnected || c.closing || c.writeFailed {
+		c.drop()
+		return
+	}
+
+	select {
+	case c.messageQueue <- msg:
+		return
+	default:
+	}
+
+	switch c.overflow {
+	case DropNewest:
+		c.drop()
+	case Disconnect:
+		c.drop()
+		c.disconnected = true
+		go c.disconnect()
+	default:
+		// the dispatcher may have taken the oldest message meanwhile, and a waiting
+		// DispatchWait may take the room freed, in which case msg is the one dropped
+		select {
+		case <-c.messageQueue:
+			c.drop()
+		default:
+		}
+		select {
+		case c.messageQueue <- msg:
+		default:
+			c.drop()
+		}
+	}
+}
+
+// DispatchWait pushes message into internal message queue, waiting for room
+// instead of applying the overflow policy. It tells whether the message was
+// queued, which it is not once the connection is closed, a write failed or its
+// dispatcher stopped.
+func (c *Connection) DispatchWait(msg interface{}) bool {
+	atomic.AddUint64(&c.dispatched, 1)
+	c.metrics.QueueDepthChanged(1)
+
+	c.queueMu.Lock()
+	gone := c.disconnected || c.closing || c.writeFailed
+	c.queueMu.Unlock()
+
+	if !gone {
+		select {
+		case <-c.stopped:
+		default:
+			select {
+			case c.messageQueue <- msg:
+				return true
+			case <-c.stopped:
+			}
+		}
+	}
+
+	c.drop()
+	return false
+}
+
+func (c *Connection) drop() {
+	atomic.AddUint64(&c.dropped, 1)
+	c.metrics.QueueDepthChanged(-1)
+	c.metrics.MessageDropped()
+}
+
+// disconnect closes the connection of a slow consumer, the reader of the
+// connection then fails and unregisters it
+func (c *Connection) disconnect() {
+	c.log.Warnf("Disconnecting slow consumer")
+
+	closeMessage := gorillaWebsocket.FormatCloseMessage(gorillaWebsocket.ClosePolicyViolation, "slow consumer")
+	_ = c.conn.WriteControl(gorillaWebsocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	_ = c.conn.Close()
+}
+
+// Close implementation
+func (c *Connection) Close(code int, reason string) {
+	c.queueMu.Lock()
+	c.closing = true
+	c.queueMu.Unlock()
+
+	closeMessage := gorillaWebsocket.FormatCloseMessage(code, reason)
+	if err := c.conn.WriteControl(gorillaWebsocket.CloseMessage, closeMessage, time.Now().Add(time.Second)); err != nil {
+		c.log.Debugf("Unable to send close frame: %v", err)
+	}
+}
+
+// Stats implementation
+func (c *Connection) Stats() DispatchStats {
+	c.queueMu.Lock()
+	disconnected := c.disconnected
+	c.queueMu.Unlock()
+
+	return DispatchStats{
+		Dispatched:   atomic.LoadUint64(&c.dispatched),
+		Written:      atomic.LoadUint64(&c.written),
+		WriteErrors:  atomic.LoadUint64(&c.writeErrors),
+		Dropped:      atomic.LoadUint64(&c.dropped),
+		Queued:       len(c.messageQueue),
+		Disconnected: disconnected,
+	}
 }
 
 func (c *Connection) initQueue() {
+	if c.queueSize <= 0 {
+		c.queueSize = DefaultQueueSize
+	}
 	if c.messageQueue == nil {
-		c.messageQueue = make(chan interface{})
+		c.messageQueue = make(chan interface{}, c.queueSize)
 	}
 	if c.stopSignal == nil {
 		c.stopSignal = make(chan struct{})
 	}
+	if c.stopped == nil {
+		c.stopped = make(chan struct{})
+	}
 }
 
 // StartDispatcher spawns a goroutine which job is to pick message from internal message queue
@@ -50,6 +199,14 @@ func (c *Connection) StartDispatcher() {
 
 	c.workerIsRunning = true
 	go func() {
+		// a nil channel never fires when the heartbeat is disabled
+		var pings <-chan time.Time
+		if c.heartbeat.Enabled() {
+			ticker := time.NewTicker(c.heartbeat.PingInterval)
+			defer ticker.Stop()
+			pings = ticker.C
+		}
+
 		for c.workerIsRunning {
 			// use channel for stop signal instead of checking for c.workerIsRunning
 			// it is because that if the toggle is off, the msg := <-c.messageQueue is still
@@ -58,16 +215,43 @@ func (c *Connection) StartDispatcher() {
 			// simply put, StopDispatcher() does not immediately kill the dispatcher goroutine
 			select {
 			case msg := <-c.messageQueue:
+				c.metrics.QueueDepthChanged(-1)
+
 				c.mu.Lock()
-				c.conn.SetWriteDeadline(time.Now().Add(time.Second))
-				_ = c.conn.WriteJSON(&msg)
+				start := time.Now()
+				c.conn.SetWriteDeadline(start.Add(time.Second))
+				err := c.conn.WriteJSON(&msg)
 				c.mu.Unlock()
+				c.metrics.MessageWritten(time.Since(start), err)
+
+				if err != nil {
+					atomic.AddUint64(&c.writeErrors, 1)
+					c.log.Warnf("Unable to write: %v", err)
+
+					c.queueMu.Lock()
+					c.writeFailed = true
+					c.queueMu.Unlock()
+				} else {
+					atomic.AddUint64(&c.written, 1)
+				}
+			case <-pings:
+				c.mu.Lock()
+				err := c.conn.WriteControl(gorillaWebsocket.PingMessage, nil, time.Now().Add(time.Second))
+				c.mu.Unlock()
+
+				if err != nil {
+					c.log.Debugf("Unable to ping: %v", err)
+				}
 			case <-c.stopSignal:
 				c.mu.Lock()
 				c.workerIsRunning = false
 				c.mu.Unlock()
 			}
 		}
+
+		// the messages left behind are never written
+		c.metrics.QueueDepthChanged(-len(c.messageQueue))
+		close(c.stopped)
 	}()
 }
 
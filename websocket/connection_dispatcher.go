@@ -3,6 +3,33 @@ package websocket
 // ConnectionDispatcher adapter
 type ConnectionDispatcher interface {
 	Dispatch(msg interface{})
+	// DispatchWait waits for room in the send queue instead of applying the
+	// overflow policy, and tells whether the message was queued
+	DispatchWait(msg interface{}) bool
 	StartDispatcher()
 	StopDispatcher()
+	// Stats returns the counters of the messages dispatched so far
+	Stats() DispatchStats
+	// Close sends the client a close frame with the code and the reason, and
+	// drops the messages dispatched afterwards. The client is expected to close
+	// the connection in return, which ends the reader of the connection.
+	Close(code int, reason string)
+}
+
+// ReconnectHint is the reason of the going away close frame sent to the
+// connections of a draining server, whose clients should reconnect
+const ReconnectHint = "server shutting down, reconnect"
+
+// DispatchStats counts the messages handed to a ConnectionDispatcher and the
+// outcome of writing them to the connection
+type DispatchStats struct {
+	Dispatched  uint64
+	Written     uint64
+	WriteErrors uint64
+	// Dropped counts the messages discarded because the send queue was full
+	Dropped uint64
+	// Queued is the number of messages waiting to be written
+	Queued int
+	// Disconnected tells whether the connection was closed for being too slow
+	Disconnected bool
 }
@@ -59,6 +59,17 @@ func (cp *ConnectionPool) Slice() []ConnectionDispatcher {
 	return conns
 }
 
+// Entries returns a copy of the internal pool map, keyed by the IDs returned by Store
+func (cp *ConnectionPool) Entries() map[int]ConnectionDispatcher {
+	cp.mu.Lock()
+	entries := make(map[int]ConnectionDispatcher, len(cp.pool))
+	for k, conn := range cp.pool {
+		entries[k] = conn
+	}
+	cp.mu.Unlock()
+	return entries
+}
+
 // Size returns the number of connections in the pool
 func (cp *ConnectionPool) Size() int {
 	return len(cp.pool)
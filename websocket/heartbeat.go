@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"time"
+
+	gorillaWebsocket "github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultPingInterval is the recommended HeartbeatOptions.PingInterval
+	DefaultPingInterval = 30 * time.Second
+	// DefaultPongTimeout is the recommended HeartbeatOptions.PongTimeout
+	DefaultPongTimeout = 10 * time.Second
+)
+
+// HeartbeatOptions configures the pings sent to a Connection.
+// The zero value disables the heartbeat.
+type HeartbeatOptions struct {
+	// PingInterval is the period of the pings
+	PingInterval time.Duration
+	// PongTimeout is how long the peer has to answer a ping before it is considered dead
+	PongTimeout time.Duration
+}
+
+// Enabled tells whether pings are sent
+func (o HeartbeatOptions) Enabled() bool {
+	return o.PingInterval > 0
+}
+
+// ExpectPongs makes the reads of conn fail once the peer has not answered the
+// pings for longer than the pong timeout, so that the reader can unregister it.
+// It must be called before the first read.
+func ExpectPongs(conn *gorillaWebsocket.Conn, opts HeartbeatOptions) {
+	if !opts.Enabled() {
+		return
+	}
+
+	extend := func() error {
+		return conn.SetReadDeadline(time.Now().Add(opts.PingInterval + opts.PongTimeout))
+	}
+
+	_ = extend()
+	conn.SetPongHandler(func(string) error {
+		return extend()
+	})
+}
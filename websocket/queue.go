@@ -0,0 +1,36 @@
+package websocket
+
+import "fmt"
+
+// OverflowPolicy tells what a Connection does with a message dispatched while its
+// send queue is full
+type OverflowPolicy string
+
+const (
+	// DropOldest discards the oldest queued message to make room for the new one
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest discards the new message
+	DropNewest OverflowPolicy = "drop-newest"
+	// Disconnect closes the connection with the policy violation close code (1008)
+	Disconnect OverflowPolicy = "disconnect"
+)
+
+// DefaultQueueSize is the default QueueOptions.Size
+const DefaultQueueSize = 256
+
+// QueueOptions configures the send queue of a Connection.
+// The zero value is a queue of DefaultQueueSize dropping the oldest messages.
+type QueueOptions struct {
+	Size     int
+	Overflow OverflowPolicy
+}
+
+// ParseOverflowPolicy returns the policy of the given name
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(name); p {
+	case DropOldest, DropNewest, Disconnect:
+		return p, nil
+	}
+
+	return "", fmt.Errorf("unknown overflow policy %q", name)
+}
@@ -0,0 +1,143 @@
+package wsclient
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// ErrReconnectFailed is sent to the errors channel when the reconnect policy gives up
+var ErrReconnectFailed = errors.New("unable to reconnect")
+
+const (
+	// DefaultInitialBackoff is the default ReconnectPolicy.InitialBackoff
+	DefaultInitialBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the default ReconnectPolicy.MaxBackoff
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// ReconnectPolicy tells how a Client reconnects after losing its connection.
+// Every reconnect resumes from the last text message ID seen by the client.
+type ReconnectPolicy struct {
+	// MaxAttempts is the number of consecutive failed attempts before giving up.
+	// Zero retries forever.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first attempt, it doubles after every
+	// failed attempt up to MaxBackoff. Zero means DefaultInitialBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff zero means DefaultMaxBackoff
+	MaxBackoff time.Duration
+	// Jitter varies every wait randomly by up to this fraction of it, between 0 and 1,
+	// so that the clients dropped together do not reconnect together
+	Jitter float64
+}
+
+// backoff returns the wait before the given attempt, starting from 1
+func (p ReconnectPolicy) backoff(attempt int, rnd *rand.Rand) time.Duration {
+	initial, max := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	if p.Jitter > 0 {
+		d += time.Duration(p.Jitter * (2*rnd.Float64() - 1) * float64(d))
+	}
+
+	return d
+}
+
+// State of the connection of a Client
+type State int
+
+const (
+	// Connecting is entered before every attempt to connect
+	Connecting State = iota
+	// Connected is entered once an attempt succeeds
+	Connected
+	// Disconnected is entered when the connection is lost, along with the cause
+	Disconnected
+)
+
+func (s State) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Disconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// StateObserverFunc is notified of the state changes of a Client, err is the
+// cause of a Disconnected state and nil otherwise
+type StateObserverFunc func(state State, err error)
+
+// AttachStateObserver attaches an observer that will be notified, in order, of
+// every state change. It must not call Listen or Stop.
+func (c *Client) AttachStateObserver(o StateObserverFunc) {
+	c.obsMutex.Lock()
+	defer c.obsMutex.Unlock()
+
+	c.stateObservers = append(c.stateObservers, o)
+}
+
+func (c *Client) setState(state State, err error) {
+	c.obsMutex.Lock()
+	observers := c.stateObservers
+	c.obsMutex.Unlock()
+
+	for _, o := range observers {
+		o(state, err)
+	}
+}
+
+// reconnect tries to connect again as the policy allows. It returns errStopped
+// when the client is stopped meanwhile.
+func (c *Client) reconnect(policy ReconnectPolicy) error {
+	var err error
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(policy.backoff(attempt, c.rnd)):
+		case <-c.stopChan:
+			return errStopped
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+
+		c.setState(Connecting, nil)
+
+		c.connMutex.Lock()
+		if !c.listening {
+			c.connMutex.Unlock()
+			return errStopped
+		}
+		err = c.connect()
+		c.connMutex.Unlock()
+
+		if err == nil {
+			c.setState(Connected, nil)
+			return nil
+		}
+
+		log.Printf("[DEBUG] reconnect attempt %d failed: %s", attempt, err)
+		c.setState(Disconnected, err)
+	}
+
+	return fmt.Errorf("%w after %d attempts: %v", ErrReconnectFailed, policy.MaxAttempts, err)
+}
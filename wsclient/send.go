@@ -0,0 +1,69 @@
+package wsclient
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// ErrNotConnected is returned when sending while the client has no connection
+var ErrNotConnected = errors.New("client is not connected")
+
+// writeTimeout bounds every write to the connection
+const writeTimeout = 10 * time.Second
+
+// Send writes the message to the server. It is safe to call concurrently with
+// the other send methods and with the control frames of the client.
+func (c *Client) Send(msg model.Message) error {
+	c.connMutex.Lock()
+	conn := c.conn
+	c.connMutex.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return conn.WriteJSON(msg)
+}
+
+// SendText sends a text message to the room the client listens to
+func (c *Client) SendText(text string) error {
+	return c.Send(model.Message{Type: model.TextMessage, Message: text})
+}
+
+// SendDirectMessage sends a text message to the user only
+func (c *Client) SendDirectMessage(toUserID int, text string) error {
+	return c.Send(model.Message{Type: model.TextMessage, Message: text, ToUserID: toUserID})
+}
+
+// Retract retracts a message written by the user of the client
+func (c *Client) Retract(messageID int64) error {
+	return c.Send(model.Message{Type: model.RetractMessage, ID: messageID})
+}
+
+// Edit replaces the body of a message written by the user of the client
+func (c *Client) Edit(messageID int64, text string) error {
+	return c.Send(model.Message{Type: model.EditMessage, ID: messageID, Message: text})
+}
+
+// SendTyping tells that the user is typing to the room the client listens to,
+// or to the given user when toUserID is not zero
+func (c *Client) SendTyping(toUserID int) error {
+	return c.Send(model.Message{Type: model.TypingMessage, ToUserID: toUserID})
+}
+
+// MarkRead marks the messages of the room the client listens to, or of the
+// direct conversation with peerID when it is not zero, as read up to messageID
+func (c *Client) MarkRead(messageID int64, peerID int) error {
+	return c.Send(model.Message{Type: model.ReadMessage, ID: messageID, ToUserID: peerID})
+}
+
+// Ack acknowledges a message received while listening in ack mode
+func (c *Client) Ack(messageID int64) error {
+	return c.Send(model.Message{Type: model.AckMessage, ID: messageID})
+}
@@ -2,32 +2,69 @@ package wsclient
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	gorillaWebsocket "github.com/gorilla/websocket"
+
+	"github.com/gifff/chat-server/model"
 )
 
 var ErrAlreadyListening = errors.New("client is already listening")
 
+// errStopped tells the listener that Stop has been called
+var errStopped = errors.New("client stopped")
+
+// ErrServerSilent is sent to the errors channel when nothing, not even a ping,
+// has been received from the server for longer than Options.IdleTimeout
+var ErrServerSilent = errors.New("server went silent")
+
+// Options configures a Client
+type Options struct {
+	// IdleTimeout is how long the client waits for a frame or a ping from the
+	// server before giving up on the connection. Zero waits forever.
+	IdleTimeout time.Duration
+	// Reconnect enables reconnecting when the connection is lost, nil gives up
+	// at the first error
+	Reconnect *ReconnectPolicy
+}
+
 type ObserverFunc func(messageType int, packet []byte)
 
+// MessageObserverFunc is notified of the frames decoded into a model.Message
+type MessageObserverFunc func(msg model.Message)
+
 type Client struct {
 	uri    string
 	header http.Header
 	ctx    context.Context
+	opts   Options
+
+	dialer           gorillaWebsocket.Dialer
+	conn             *gorillaWebsocket.Conn
+	connMutex        sync.Mutex
+	writeMutex       sync.Mutex
+	observers        []ObserverFunc
+	messageObservers []MessageObserverFunc
+	stateObservers   []StateObserverFunc
+	obsMutex         sync.Mutex
+	listening        bool
+	stopChan         chan struct{}
+	listenErrChan    chan error
 
-	dialer        gorillaWebsocket.Dialer
-	conn          *gorillaWebsocket.Conn
-	connMutex     sync.Mutex
-	observers     []ObserverFunc
-	obsMutex      sync.Mutex
-	listening     bool
-	stopChan      chan struct{}
-	listenErrChan chan error
+	// lastSeenID is the highest text message ID received, the reconnects resume from it
+	lastSeenID int64
+	rnd        *rand.Rand
 }
 
 func NewClient(uri string, header http.Header) *Client {
@@ -35,16 +72,27 @@ func NewClient(uri string, header http.Header) *Client {
 }
 
 func NewClientContext(ctx context.Context, uri string, header http.Header) *Client {
+	return NewClientOptions(ctx, uri, header, Options{})
+}
+
+func NewClientOptions(ctx context.Context, uri string, header http.Header, opts Options) *Client {
 	return &Client{
 		ctx:    ctx,
 		uri:    uri,
 		header: header,
+		opts:   opts,
 
 		stopChan:      make(chan struct{}, 1),
 		listenErrChan: make(chan error, 1),
+		rnd:           rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// LastSeenID returns the highest text message ID received so far
+func (c *Client) LastSeenID() int64 {
+	return atomic.LoadInt64(&c.lastSeenID)
+}
+
 // AttachObserver attaches an observer that will be notified when a
 // message is consumed.
 func (c *Client) AttachObserver(o ObserverFunc) {
@@ -58,6 +106,27 @@ func (c *Client) AttachObserver(o ObserverFunc) {
 	c.observers = append(c.observers, o)
 }
 
+// AttachMessageObserver attaches an observer that will be notified of every
+// message decoded from the consumed frames. Unlike the ObserverFunc ones, the
+// message observers are called in order from the goroutine reading the
+// connection, so they should return quickly.
+func (c *Client) AttachMessageObserver(o MessageObserverFunc) {
+	c.obsMutex.Lock()
+	defer c.obsMutex.Unlock()
+
+	c.messageObservers = append(c.messageObservers, o)
+}
+
+// AttachMessageTypeObserver attaches a message observer notified of the
+// messages of the given type only
+func (c *Client) AttachMessageTypeObserver(messageType model.MessageType, o MessageObserverFunc) {
+	c.AttachMessageObserver(func(msg model.Message) {
+		if msg.Type == messageType {
+			o(msg)
+		}
+	})
+}
+
 // Listen starts the connection to host, subscribe for messages through
 // established connection and notify the attached observers.
 //
@@ -74,11 +143,20 @@ func (c *Client) Listen() (<-chan error, error) {
 		return nil, ErrAlreadyListening
 	}
 
+	// forget the stop signal of a previous Stop the listener did not wait for
+	select {
+	case <-c.stopChan:
+	default:
+	}
+
+	c.setState(Connecting, nil)
 	err := c.connect()
 	if err != nil {
+		c.setState(Disconnected, err)
 		return nil, err
 	}
 	c.listening = true
+	c.setState(Connected, nil)
 
 	go c.listenMessages()
 
@@ -86,11 +164,12 @@ func (c *Client) Listen() (<-chan error, error) {
 }
 
 func (c *Client) connect() error {
-	conn, resp, err := c.dialer.DialContext(c.ctx, c.uri, c.header)
+	conn, resp, err := c.dialer.DialContext(c.ctx, c.resumeURI(), c.header)
 	if err != nil {
 		return err
 	}
 	c.conn = conn
+	c.watchServer(conn)
 
 	log.Printf("[DEBUG] response: code=%d", resp.StatusCode)
 	defer resp.Body.Close()
@@ -98,25 +177,132 @@ func (c *Client) connect() error {
 	return nil
 }
 
+// resumeURI returns the URI to connect to, asking the server to replay the
+// messages after the last seen one
+func (c *Client) resumeURI() string {
+	lastSeenID := c.LastSeenID()
+	if lastSeenID == 0 {
+		return c.uri
+	}
+
+	u, err := url.Parse(c.uri)
+	if err != nil {
+		return c.uri
+	}
+	q := u.Query()
+	q.Set("since", strconv.FormatInt(lastSeenID, 10))
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// watchServer answers the pings of the server and, with an idle timeout, makes the
+// reads fail once the server has been silent for too long
+func (c *Client) watchServer(conn *gorillaWebsocket.Conn) {
+	c.extendIdleDeadline(conn)
+
+	conn.SetPingHandler(func(appData string) error {
+		c.extendIdleDeadline(conn)
+
+		c.writeMutex.Lock()
+		defer c.writeMutex.Unlock()
+
+		err := conn.WriteControl(gorillaWebsocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		if err == gorillaWebsocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+}
+
+func (c *Client) extendIdleDeadline(conn *gorillaWebsocket.Conn) {
+	if c.opts.IdleTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(c.opts.IdleTimeout))
+	}
+}
+
+// listenMessages reads the connection until Stop is called. A lost connection
+// is sent to the errors channel, unless the reconnect policy brings it back.
 func (c *Client) listenMessages() {
-listenerLoop:
 	for {
-		select {
-		case <-c.stopChan:
-			break listenerLoop
-		default:
-			msgType, pkt, err := c.conn.ReadMessage()
-			if err != nil {
+		c.connMutex.Lock()
+		conn := c.conn
+		c.connMutex.Unlock()
+
+		err := c.readMessages(conn)
+		if !c.isListening() {
+			return
+		}
+
+		c.connMutex.Lock()
+		conn.Close()
+		c.conn = nil
+		c.connMutex.Unlock()
+		c.setState(Disconnected, err)
+
+		if c.opts.Reconnect == nil {
+			c.listenErrChan <- err
+			return
+		}
 
+		if err := c.reconnect(*c.opts.Reconnect); err != nil {
+			if err != errStopped {
 				c.listenErrChan <- err
-				break
 			}
+			return
+		}
+	}
+}
 
-			c.notifyObservers(msgType, pkt)
+// readMessages notifies the observers of the messages of the connection until
+// it fails
+func (c *Client) readMessages(conn *gorillaWebsocket.Conn) error {
+	for {
+		msgType, pkt, err := conn.ReadMessage()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				err = fmt.Errorf("%w: %v", ErrServerSilent, err)
+			}
+
+			return err
+		}
+
+		c.extendIdleDeadline(conn)
+		c.notifyObservers(msgType, pkt)
+
+		var msg model.Message
+		if err := json.Unmarshal(pkt, &msg); err != nil {
+			log.Printf("[DEBUG] unable to decode message: %s", err)
+			continue
 		}
+		c.trackLastSeen(msg)
+		c.notifyMessageObservers(msg)
 	}
 }
 
+func (c *Client) trackLastSeen(msg model.Message) {
+	if msg.Type == model.TextMessage && msg.ID > atomic.LoadInt64(&c.lastSeenID) {
+		atomic.StoreInt64(&c.lastSeenID, msg.ID)
+	}
+}
+
+func (c *Client) notifyMessageObservers(msg model.Message) {
+	c.obsMutex.Lock()
+	observers := c.messageObservers
+	c.obsMutex.Unlock()
+
+	for _, o := range observers {
+		o(msg)
+	}
+}
+
+func (c *Client) isListening() bool {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	return c.listening
+}
+
 func (c *Client) notifyObservers(messageType int, packet []byte) {
 	for _, o := range c.observers {
 		go o(messageType, packet)
@@ -126,24 +312,31 @@ func (c *Client) notifyObservers(messageType int, packet []byte) {
 // Stop signals the Client to cease listening and close the underlying
 // connection.
 func (c *Client) Stop(timeout time.Duration) error {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
 	if !c.listening {
 		return nil
 	}
 
-	c.connMutex.Lock()
-	defer c.connMutex.Unlock()
-
 	c.listening = false
 	c.stopChan <- struct{}{}
 
+	// the connection is gone while reconnecting
+	if c.conn == nil {
+		return nil
+	}
+
 	return c.close(timeout)
 }
 
 func (c *Client) close(timeout time.Duration) error {
+	c.writeMutex.Lock()
 	err := c.conn.WriteControl(
 		gorillaWebsocket.CloseMessage,
 		gorillaWebsocket.FormatCloseMessage(gorillaWebsocket.CloseNormalClosure, ""),
 		time.Now().Add(timeout))
+	c.writeMutex.Unlock()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,166 @@
+package wsgateway
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/websocket"
+)
+
+// ackingDispatcher redelivers the text messages dispatched to a connection in ack
+// mode until the client acknowledges them, waiting twice as long before every
+// retry. The messages which are still unacknowledged after the last retry are
+// handed to expire, the ones pending when the connection goes away are returned
+// by stop.
+type ackingDispatcher struct {
+	websocket.ConnectionDispatcher
+	timeout    time.Duration
+	maxRetries int
+	expire     func(msg model.Message)
+
+	mu      sync.Mutex
+	stopped bool
+	pending map[int64]*pendingDelivery
+	acked   uint64
+	retried uint64
+	expired uint64
+}
+
+// pendingDelivery is a message waiting for its ack
+type pendingDelivery struct {
+	message  model.Message
+	attempts int
+	timer    *time.Timer
+}
+
+func newAckingDispatcher(conn websocket.ConnectionDispatcher, timeout time.Duration, maxRetries int, expire func(msg model.Message)) *ackingDispatcher {
+	return &ackingDispatcher{
+		ConnectionDispatcher: conn,
+		timeout:              timeout,
+		maxRetries:           maxRetries,
+		expire:               expire,
+		pending:              make(map[int64]*pendingDelivery),
+	}
+}
+
+// Dispatch implementation
+func (a *ackingDispatcher) Dispatch(msg interface{}) {
+	if m, ok := msg.(model.Message); ok && m.Type == model.TextMessage && m.ID > 0 {
+		a.track(m)
+	}
+
+	a.ConnectionDispatcher.Dispatch(msg)
+}
+
+// DispatchWait implementation
+func (a *ackingDispatcher) DispatchWait(msg interface{}) bool {
+	if m, ok := msg.(model.Message); ok && m.Type == model.TextMessage && m.ID > 0 {
+		a.track(m)
+	}
+
+	return a.ConnectionDispatcher.DispatchWait(msg)
+}
+
+func (a *ackingDispatcher) track(msg model.Message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopped {
+		return
+	}
+
+	if p, ok := a.pending[msg.ID]; ok {
+		p.timer.Stop()
+	}
+
+	a.pending[msg.ID] = &pendingDelivery{
+		message:  msg,
+		attempts: 1,
+		timer:    a.retryAfter(msg.ID, a.timeout),
+	}
+}
+
+func (a *ackingDispatcher) retryAfter(messageID int64, d time.Duration) *time.Timer {
+	return time.AfterFunc(d, func() {
+		a.retry(messageID)
+	})
+}
+
+// retry redelivers the message unless it has been acknowledged meanwhile, or
+// expires it once the retries are exhausted
+func (a *ackingDispatcher) retry(messageID int64) {
+	a.mu.Lock()
+	p, ok := a.pending[messageID]
+	if !ok || a.stopped {
+		a.mu.Unlock()
+		return
+	}
+
+	if p.attempts > a.maxRetries {
+		delete(a.pending, messageID)
+		a.expired++
+		a.mu.Unlock()
+
+		a.expire(p.message)
+		return
+	}
+
+	p.timer = a.retryAfter(messageID, a.timeout<<uint(p.attempts))
+	p.attempts++
+	a.retried++
+	a.mu.Unlock()
+
+	a.ConnectionDispatcher.Dispatch(p.message)
+}
+
+// ack tells whether the message was waiting for its ack
+func (a *ackingDispatcher) ack(messageID int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, ok := a.pending[messageID]
+	if !ok {
+		return false
+	}
+
+	p.timer.Stop()
+	delete(a.pending, messageID)
+	a.acked++
+
+	return true
+}
+
+// stop cancels the redeliveries and returns the unacknowledged messages ordered by ID
+func (a *ackingDispatcher) stop() []model.Message {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stopped = true
+
+	messages := make([]model.Message, 0, len(a.pending))
+	for id, p := range a.pending {
+		p.timer.Stop()
+		messages = append(messages, p.message)
+		delete(a.pending, id)
+	}
+	a.expired += uint64(len(messages))
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+
+	return messages
+}
+
+// fillStatus adds the ack counters to the status
+func (a *ackingDispatcher) fillStatus(status *DeliveryStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status.Acked = a.acked
+	status.Pending = len(a.pending)
+	status.Retried = a.retried
+	status.Expired = a.expired
+}
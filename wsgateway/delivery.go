@@ -0,0 +1,162 @@
+package wsgateway
+
+import (
+	"sort"
+
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/websocket"
+)
+
+// DeliveryStatus reports the delivery of the messages dispatched to a connection.
+// The ack counters stay zero unless the connection subscribed in ack mode.
+type DeliveryStatus struct {
+	RegistrationID int
+	Subscription   Subscription
+	websocket.DispatchStats
+	Acked   uint64
+	Pending int
+	Retried uint64
+	// Expired counts the unacknowledged messages moved to the offline queue
+	Expired uint64
+}
+
+// DispatchTotals sums the websocket.DispatchStats of the connections
+type DispatchTotals struct {
+	Dispatched  uint64
+	Written     uint64
+	WriteErrors uint64
+	Dropped     uint64
+	// Disconnected counts the slow consumers closed by their overflow policy
+	Disconnected uint64
+}
+
+func (t *DispatchTotals) add(stats websocket.DispatchStats) {
+	t.Dispatched += stats.Dispatched
+	t.Written += stats.Written
+	t.WriteErrors += stats.WriteErrors
+	t.Dropped += stats.Dropped
+	if stats.Disconnected {
+		t.Disconnected++
+	}
+}
+
+// Ack implementation
+func (w *wsGateway) Ack(userID int, registrationID int, messageID int64) bool {
+	w.mu.RLock()
+	userConnectionPool, ok := w.userConnectionPoolMap[userID]
+	w.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	conn, ok := ackingOf(userConnectionPool.Get(registrationID))
+	if !ok {
+		return false
+	}
+
+	return conn.ack(messageID)
+}
+
+// DeliveryStatus implementation
+func (w *wsGateway) DeliveryStatus(userID int) []DeliveryStatus {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	userConnectionPool, ok := w.userConnectionPoolMap[userID]
+	if !ok {
+		return []DeliveryStatus{}
+	}
+
+	statuses := []DeliveryStatus{}
+	for registrationID, conn := range userConnectionPool.Entries() {
+		status := DeliveryStatus{
+			RegistrationID: registrationID,
+			Subscription:   w.connectionSubscriptionMap[conn],
+			DispatchStats:  conn.Stats(),
+		}
+		if acking, ok := ackingOf(conn); ok {
+			acking.fillStatus(&status)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].RegistrationID < statuses[j].RegistrationID
+	})
+
+	return statuses
+}
+
+// DispatchTotals implementation
+func (w *wsGateway) DispatchTotals() DispatchTotals {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	totals := w.unregisteredTotals
+	for _, userConnectionPool := range w.userConnectionPoolMap {
+		for _, conn := range userConnectionPool.Slice() {
+			totals.add(conn.Stats())
+		}
+	}
+
+	return totals
+}
+
+// enqueueOffline keeps the messages undelivered to the user until their next
+// connection, in the order of their IDs, dropping the oldest queued ones beyond
+// the queue size. A message already queued is not queued twice, as both the
+// acknowledgements and an interrupted flush may hand it back.
+// The caller must hold the lock.
+func (w *wsGateway) enqueueOffline(userID int, msgs ...model.Message) {
+	if w.offlineQueueSize <= 0 {
+		return
+	}
+
+	queue := w.offlineQueues[userID]
+	queued := make(map[int64]struct{}, len(queue))
+	for _, msg := range queue {
+		queued[msg.ID] = struct{}{}
+	}
+	for _, msg := range msgs {
+		if _, ok := queued[msg.ID]; ok {
+			continue
+		}
+		queued[msg.ID] = struct{}{}
+		queue = append(queue, msg)
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].ID < queue[j].ID
+	})
+	if len(queue) > w.offlineQueueSize {
+		queue = queue[len(queue)-w.offlineQueueSize:]
+	}
+	w.offlineQueues[userID] = queue
+}
+
+// takeOffline removes from the offline queue of the user and returns the messages
+// the subscription listens to. Only a connection in ack mode takes them, as the
+// others would lose the ones they fail to read. The caller must hold the lock.
+func (w *wsGateway) takeOffline(userID int, subscription Subscription) []model.Message {
+	if !subscription.Ack {
+		return nil
+	}
+
+	var taken, kept []model.Message
+	for _, msg := range w.offlineQueues[userID] {
+		if msg.ToUserID != 0 || msg.RoomID == subscription.RoomID {
+			taken = append(taken, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(w.offlineQueues, userID)
+	} else {
+		w.offlineQueues[userID] = kept
+	}
+
+	return taken
+}
@@ -0,0 +1,51 @@
+package wsgateway
+
+import (
+	"time"
+
+	gorillaWebsocket "github.com/gorilla/websocket"
+
+	"github.com/gifff/chat-server/websocket"
+)
+
+// drainPollInterval is how often Drain checks whether the pools are empty
+const drainPollInterval = 20 * time.Millisecond
+
+// Drain implementation
+func (w *wsGateway) Drain(timeout time.Duration) bool {
+	w.mu.Lock()
+	w.draining = true
+	var conns []websocket.ConnectionDispatcher
+	for _, userConnectionPool := range w.userConnectionPoolMap {
+		conns = append(conns, userConnectionPool.Slice()...)
+	}
+	w.mu.Unlock()
+
+	w.log.Infof("Draining %d connections", len(conns))
+	for _, conn := range conns {
+		goAway(conn)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for w.TotalConnections() > 0 {
+		if time.Now().After(deadline) {
+			w.log.Warnf("Drain timed out with %d connections left", w.TotalConnections())
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+
+	return true
+}
+
+// Draining implementation
+func (w *wsGateway) Draining() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.draining
+}
+
+func goAway(conn websocket.ConnectionDispatcher) {
+	conn.Close(gorillaWebsocket.CloseGoingAway, websocket.ReconnectHint)
+}
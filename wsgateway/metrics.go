@@ -0,0 +1,42 @@
+package wsgateway
+
+import (
+	"github.com/gifff/chat-server/metrics"
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/websocket"
+)
+
+// meteredDispatcher counts the messages dispatched to the connection by type. It
+// wraps the other dispatchers, so that a message is counted once whatever they
+// do with it.
+type meteredDispatcher struct {
+	websocket.ConnectionDispatcher
+	metrics metrics.Metrics
+}
+
+// Dispatch implementation
+func (m *meteredDispatcher) Dispatch(msg interface{}) {
+	if message, ok := msg.(model.Message); ok {
+		m.metrics.MessageDelivered(message.Type)
+	}
+
+	m.ConnectionDispatcher.Dispatch(msg)
+}
+
+// DispatchWait implementation
+func (m *meteredDispatcher) DispatchWait(msg interface{}) bool {
+	if message, ok := msg.(model.Message); ok {
+		m.metrics.MessageDelivered(message.Type)
+	}
+
+	return m.ConnectionDispatcher.DispatchWait(msg)
+}
+
+// unmetered returns the dispatcher wrapped by the metered one of a registered connection
+func unmetered(conn websocket.ConnectionDispatcher) websocket.ConnectionDispatcher {
+	if metered, ok := conn.(*meteredDispatcher); ok {
+		return metered.ConnectionDispatcher
+	}
+
+	return conn
+}
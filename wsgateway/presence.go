@@ -0,0 +1,75 @@
+package wsgateway
+
+import (
+	"time"
+
+	"github.com/gifff/chat-server/model"
+)
+
+// markOnline is called with the lock held when the user registers a connection.
+// It cancels the pending offline transition of the user if any, otherwise it
+// announces the user as online the first time.
+func (w *wsGateway) markOnline(userID int) {
+	if timer, ok := w.offlineTimers[userID]; ok {
+		timer.Stop()
+		delete(w.offlineTimers, userID)
+		return
+	}
+
+	if _, ok := w.onlineUsers[userID]; ok {
+		return
+	}
+
+	w.onlineUsers[userID] = struct{}{}
+	w.dispatchPresence(userID, true)
+}
+
+// markOffline is called with the lock held when the last connection of the user
+// unregisters. The user goes offline once the grace period elapses without any
+// new connection.
+func (w *wsGateway) markOffline(userID int) {
+	if w.presenceGracePeriod <= 0 {
+		w.setOffline(userID)
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(w.presenceGracePeriod, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		// a reconnect within the grace period has stopped or replaced the timer
+		if w.offlineTimers[userID] != timer {
+			return
+		}
+
+		delete(w.offlineTimers, userID)
+		w.setOffline(userID)
+	})
+	w.offlineTimers[userID] = timer
+}
+
+func (w *wsGateway) setOffline(userID int) {
+	delete(w.onlineUsers, userID)
+	w.dispatchPresence(userID, false)
+}
+
+// dispatchPresence sends the presence event of the user to the connections
+// subscribed to presence. The caller must hold the lock.
+func (w *wsGateway) dispatchPresence(userID int, online bool) {
+	user := w.userDirectory.Profile(userID)
+	at := time.Now()
+
+	for viewerID, userConnectionPool := range w.userConnectionPoolMap {
+		message := model.PresenceFromDomain(user, online, at, viewerID)
+
+		for connID, conn := range userConnectionPool.Entries() {
+			if !w.connectionSubscriptionMap[conn].Presence {
+				continue
+			}
+
+			w.logDispatch(viewerID, connID, message)
+			conn.Dispatch(message)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package wsgateway
+
+import (
+	"sync"
+
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/websocket"
+)
+
+// resumingDispatcher holds back the live messages dispatched to the connection
+// while the messages it missed are replayed from the store. Since the connection
+// is registered before the store is read, a message is either replayed, held
+// back or both, and the copies of the replayed ones are dropped on resume. The
+// IDs are not stored in order, a lower one may be stored after the replay read
+// past it, so the replayed IDs are remembered rather than the last one. It
+// wraps the acking dispatcher, so the replayed messages are acknowledged too.
+type resumingDispatcher struct {
+	websocket.ConnectionDispatcher
+
+	mu        sync.Mutex
+	replaying bool
+	held      []interface{}
+	replayed  map[int64]struct{}
+}
+
+func newResumingDispatcher(conn websocket.ConnectionDispatcher) *resumingDispatcher {
+	return &resumingDispatcher{
+		ConnectionDispatcher: conn,
+		replaying:            true,
+		replayed:             make(map[int64]struct{}),
+	}
+}
+
+// Dispatch implementation
+func (r *resumingDispatcher) Dispatch(msg interface{}) {
+	r.mu.Lock()
+	if r.replaying {
+		r.held = append(r.held, msg)
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+
+	r.ConnectionDispatcher.Dispatch(msg)
+}
+
+// DispatchWait implementation
+func (r *resumingDispatcher) DispatchWait(msg interface{}) bool {
+	r.mu.Lock()
+	if r.replaying {
+		r.held = append(r.held, msg)
+		r.mu.Unlock()
+		return true
+	}
+	r.mu.Unlock()
+
+	return r.ConnectionDispatcher.DispatchWait(msg)
+}
+
+// replay dispatches the missed message, bypassing the held back ones. It waits
+// for room in the send queue, so that a long replay is not cut short by the
+// overflow policy, and tells whether the message was queued.
+func (r *resumingDispatcher) replay(msg model.Message) bool {
+	r.mu.Lock()
+	r.replayed[msg.ID] = struct{}{}
+	r.mu.Unlock()
+
+	return r.ConnectionDispatcher.DispatchWait(msg)
+}
+
+// resume flushes the held back messages, except the ones already replayed, and
+// switches to live delivery. The lock is released while waiting for room in the
+// send queue, the messages held back meanwhile are flushed in the next round.
+func (r *resumingDispatcher) resume() {
+	for {
+		r.mu.Lock()
+		held := r.held
+		r.held = nil
+		if len(held) == 0 {
+			r.replaying = false
+			r.replayed = nil
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+
+		for _, msg := range held {
+			if r.wasReplayed(msg) {
+				continue
+			}
+
+			r.ConnectionDispatcher.DispatchWait(msg)
+		}
+	}
+}
+
+// wasReplayed tells whether msg is the live copy of a replayed text message
+func (r *resumingDispatcher) wasReplayed(msg interface{}) bool {
+	m, ok := msg.(model.Message)
+	if !ok || m.Type != model.TextMessage {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, replayed := r.replayed[m.ID]
+	return replayed
+}
+
+// ackingOf returns the acking dispatcher of a registered connection in ack mode
+func ackingOf(conn websocket.ConnectionDispatcher) (*ackingDispatcher, bool) {
+	conn = unmetered(conn)
+	if resumer, ok := conn.(*resumingDispatcher); ok {
+		conn = resumer.ConnectionDispatcher
+	}
+
+	acking, ok := conn.(*ackingDispatcher)
+	return acking, ok
+}
+
+// resumerOf returns the resuming dispatcher of a registered connection
+func (w *wsGateway) resumerOf(userID int, registrationID int) (*resumingDispatcher, bool) {
+	w.mu.RLock()
+	userConnectionPool, ok := w.userConnectionPoolMap[userID]
+	w.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	resumer, ok := unmetered(userConnectionPool.Get(registrationID)).(*resumingDispatcher)
+	return resumer, ok
+}
+
+// Replay implementation
+func (w *wsGateway) Replay(userID int, registrationID int, message model.Message) bool {
+	resumer, ok := w.resumerOf(userID, registrationID)
+	if !ok {
+		return false
+	}
+
+	// the replay bypasses the metered dispatcher
+	w.metrics.MessageDelivered(message.Type)
+	return resumer.replay(message)
+}
+
+// Resume implementation
+func (w *wsGateway) Resume(userID int, registrationID int) {
+	if resumer, ok := w.resumerOf(userID, registrationID); ok {
+		resumer.resume()
+	}
+}
@@ -0,0 +1,42 @@
+package wsgateway
+
+import (
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/model"
+)
+
+// EnqueueTyping implementation
+func (w *wsGateway) EnqueueTyping(event domain.TypingEvent, members []int) {
+	author := w.userDirectory.Profile(event.UserID)
+	messageFor := func(userID int) model.Message {
+		return model.TypingFromDomain(event, author, userID)
+	}
+
+	if event.IsDirect() {
+		w.sendTo([]int{event.ToUserID}, messageFor)
+		return
+	}
+
+	isMember := w.roomAudience(event.RoomID, members)
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for userID, userConnectionPool := range w.userConnectionPoolMap {
+		// the typing user knows it is typing
+		if userID == event.UserID || !isMember(userID) {
+			continue
+		}
+
+		message := messageFor(userID)
+
+		for connID, conn := range userConnectionPool.Entries() {
+			if w.connectionSubscriptionMap[conn].RoomID != event.RoomID {
+				continue
+			}
+
+			w.logDispatch(userID, connID, message)
+			conn.Dispatch(message)
+		}
+	}
+}
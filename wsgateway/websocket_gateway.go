@@ -1,11 +1,112 @@
 package wsgateway
 
-import "github.com/gifff/chat-server/websocket"
+import (
+	"time"
+
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/model"
+	"github.com/gifff/chat-server/websocket"
+)
 
 // WebsocketGateway adapter
 type WebsocketGateway interface {
-	EnqueueMessageBroadcast(messageID int, message string, fromUserID int)
-	RegisterConnection(userID int, connection websocket.ConnectionDispatcher) (registrationID int)
+	// EnqueueMessageBroadcast delivers the room message to the connections listening
+	// to its room. The room events are delivered to the given members of the room,
+	// or to the members known to RoomMembership when there are none.
+	EnqueueMessageBroadcast(message domain.Message, members []int)
+	// EnqueueDirectMessage delivers the direct message to every connection of its sender and recipient
+	EnqueueDirectMessage(message domain.Message)
+	// EnqueueRetractBroadcast and EnqueueEditBroadcast deliver the events of both room and direct messages
+	EnqueueRetractBroadcast(message domain.Message, members []int)
+	EnqueueEditBroadcast(message domain.Message, members []int)
+	// EnqueueTyping relays the ephemeral typing event to the other users of its
+	// room, or to its recipient when it is direct
+	EnqueueTyping(event domain.TypingEvent, members []int)
+	// EnqueueReadReceipt notifies the connections of the reader and of the author
+	// of the read message that the reader has read up to that message
+	EnqueueReadReceipt(marker domain.ReadMarker, authorID int)
+	// EnqueueUserUpdate notifies every connection of the new profile of the user
+	EnqueueUserUpdate(user domain.User)
+	// RegisterConnection registers the connection of the user with the events it subscribes to
+	RegisterConnection(userID int, subscription Subscription, connection websocket.ConnectionDispatcher) (registrationID int)
 	UnregisterConnection(userID int, registrationID int)
 	TotalConnections() int
+	// ConnectionsByUser returns the number of connections of every connected user
+	ConnectionsByUser() map[int]int
+	// OnlineUsers returns the IDs of the online users in ascending order
+	OnlineUsers() []int
+	// Ack acknowledges the delivery of the message to a connection in ack mode
+	// and tells whether the message was waiting for it
+	Ack(userID int, registrationID int, messageID int64) bool
+	// DeliveryStatus reports the delivery to every connection of the user ordered by registration ID
+	DeliveryStatus(userID int) []DeliveryStatus
+	// DispatchTotals sums the dispatch counters of every connection registered so far
+	DispatchTotals() DispatchTotals
+	// Drain sends every registered connection, and the ones registered afterwards,
+	// a going away close frame with websocket.ReconnectHint, then waits up to the
+	// timeout for their clients to close them. It tells whether every connection
+	// was unregistered in time.
+	Drain(timeout time.Duration) bool
+	// Draining tells whether a drain started
+	Draining() bool
+	// Replay dispatches a message missed by a connection registered with
+	// Subscription.Resume ahead of the live messages held back meanwhile. It
+	// waits for room in the send queue instead of applying the overflow policy,
+	// and tells whether the message was queued.
+	Replay(userID int, registrationID int, message model.Message) bool
+	// Resume dispatches the live messages held back during the replay, except the
+	// replayed text messages, and switches the connection back to live delivery
+	Resume(userID int, registrationID int)
+}
+
+// Subscription describes what a connection listens to
+type Subscription struct {
+	// RoomID is the room whose messages are delivered to the connection
+	RoomID int
+	// Presence subscribes the connection to the presence events of every user
+	Presence bool
+	// Ack makes the client acknowledge every text message, the unacknowledged ones
+	// are redelivered and then kept in the offline queue of the user
+	Ack bool
+	// Resume holds back the live messages until the ones the connection missed
+	// are replayed with Replay and Resume is called
+	Resume bool
+}
+
+// Options tunes the gateway
+type Options struct {
+	// PresenceGracePeriod is how long a user without connections stays online,
+	// so that a quick reconnect does not flap their presence. Zero disables it.
+	PresenceGracePeriod time.Duration
+	// AckTimeout is how long a connection in ack mode has to acknowledge a message
+	// before its first redelivery, the timeout doubles after every redelivery.
+	// Zero means DefaultAckTimeout.
+	AckTimeout time.Duration
+	// MaxDeliveryRetries is the number of redeliveries of an unacknowledged message
+	MaxDeliveryRetries int
+	// OfflineQueueSize is the number of undelivered messages kept for every user
+	// until their next connection. Zero means DefaultOfflineQueueSize.
+	OfflineQueueSize int
+}
+
+const (
+	// DefaultPresenceGracePeriod is the recommended Options.PresenceGracePeriod
+	DefaultPresenceGracePeriod = 5 * time.Second
+	// DefaultAckTimeout is the default Options.AckTimeout
+	DefaultAckTimeout = 2 * time.Second
+	// DefaultMaxDeliveryRetries is the recommended Options.MaxDeliveryRetries
+	DefaultMaxDeliveryRetries = 3
+	// DefaultOfflineQueueSize is the default Options.OfflineQueueSize
+	DefaultOfflineQueueSize = 100
+)
+
+// RoomMembership tells the gateway which users may receive the messages of a room
+// whose events do not carry its members
+type RoomMembership interface {
+	IsMember(roomID int, userID int) bool
+}
+
+// UserDirectory gives the gateway the profiles of the message authors
+type UserDirectory interface {
+	Profile(userID int) domain.User
 }
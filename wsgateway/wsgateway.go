@@ -1,61 +1,261 @@
 package wsgateway
 
 import (
-	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/gifff/chat-server/domain"
+	"github.com/gifff/chat-server/logger"
+	"github.com/gifff/chat-server/metrics"
 	"github.com/gifff/chat-server/model"
 	"github.com/gifff/chat-server/websocket"
 )
 
 // New returns Websocket object which satisfies the WebsocketGateway contract
-func New() WebsocketGateway {
+func New(roomMembership RoomMembership, userDirectory UserDirectory, m metrics.Metrics, l logger.Logger, opts Options) WebsocketGateway {
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = DefaultAckTimeout
+	}
+	if opts.OfflineQueueSize <= 0 {
+		opts.OfflineQueueSize = DefaultOfflineQueueSize
+	}
+
 	return &wsGateway{
-		userConnectionPoolMap: make(map[int]*websocket.ConnectionPool),
+		roomMembership:            roomMembership,
+		userDirectory:             userDirectory,
+		metrics:                   m,
+		log:                       l.Component("gateway"),
+		presenceGracePeriod:       opts.PresenceGracePeriod,
+		ackTimeout:                opts.AckTimeout,
+		maxDeliveryRetries:        opts.MaxDeliveryRetries,
+		offlineQueueSize:          opts.OfflineQueueSize,
+		userConnectionPoolMap:     make(map[int]*websocket.ConnectionPool),
+		connectionSubscriptionMap: make(map[websocket.ConnectionDispatcher]Subscription),
+		onlineUsers:               make(map[int]struct{}),
+		offlineTimers:             make(map[int]*time.Timer),
+		offlineQueues:             make(map[int][]model.Message),
 	}
 }
 
 // wsGateway is WebsocketGateway implementation
 type wsGateway struct {
 	mu                    sync.RWMutex
+	roomMembership        RoomMembership
+	userDirectory         UserDirectory
+	metrics               metrics.Metrics
+	log                   logger.Logger
+	presenceGracePeriod   time.Duration
+	ackTimeout            time.Duration
+	maxDeliveryRetries    int
+	offlineQueueSize      int
 	userConnectionPoolMap map[int]*websocket.ConnectionPool
+	// connectionSubscriptionMap holds what each registered connection listens to
+	connectionSubscriptionMap map[websocket.ConnectionDispatcher]Subscription
+	// onlineUsers holds the users with connections, or within the grace period
+	// of their last one, whose pending offline transition is in offlineTimers
+	onlineUsers   map[int]struct{}
+	offlineTimers map[int]*time.Timer
+	// offlineQueues holds the messages which could not be delivered to the users
+	offlineQueues map[int][]model.Message
+	// unregisteredTotals keeps the dispatch counters of the closed connections
+	unregisteredTotals DispatchTotals
+	// draining turns away the connections, the ones registered meanwhile included
+	draining bool
 }
 
 // EnqueueMessageBroadcast implementation
-func (w *wsGateway) EnqueueMessageBroadcast(messageID int, message string, fromUserID int) {
+func (w *wsGateway) EnqueueMessageBroadcast(msg domain.Message, members []int) {
+	author := w.userDirectory.Profile(msg.UserID)
+	w.broadcast(msg.RoomID, members, func(userID int) model.Message {
+		return model.MessageFromDomain(msg, author, userID)
+	})
+}
+
+// EnqueueDirectMessage implementation
+func (w *wsGateway) EnqueueDirectMessage(msg domain.Message) {
+	author := w.userDirectory.Profile(msg.UserID)
+	w.sendTo([]int{msg.UserID, msg.ToUserID}, func(userID int) model.Message {
+		return model.MessageFromDomain(msg, author, userID)
+	})
+}
+
+// EnqueueRetractBroadcast implementation
+func (w *wsGateway) EnqueueRetractBroadcast(msg domain.Message, members []int) {
+	author := w.userDirectory.Profile(msg.UserID)
+	w.deliver(msg, members, func(userID int) model.Message {
+		return model.RetractionFromDomain(msg, author, userID)
+	})
+}
+
+// EnqueueEditBroadcast implementation
+func (w *wsGateway) EnqueueEditBroadcast(msg domain.Message, members []int) {
+	author := w.userDirectory.Profile(msg.UserID)
+	w.deliver(msg, members, func(userID int) model.Message {
+		return model.EditFromDomain(msg, author, userID)
+	})
+}
+
+// EnqueueReadReceipt implementation
+func (w *wsGateway) EnqueueReadReceipt(marker domain.ReadMarker, authorID int) {
+	recipients := []int{marker.UserID}
+	if authorID != marker.UserID {
+		recipients = append(recipients, authorID)
+	}
+
+	reader := w.userDirectory.Profile(marker.UserID)
+	w.sendTo(recipients, func(userID int) model.Message {
+		return model.ReadReceiptFromDomain(marker, reader, userID)
+	})
+}
+
+// EnqueueUserUpdate implementation
+func (w *wsGateway) EnqueueUserUpdate(user domain.User) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for userID, userConnectionPool := range w.userConnectionPoolMap {
+		message := model.UserUpdateFromDomain(user, userID)
+
+		for connID, conn := range userConnectionPool.Entries() {
+			w.logDispatch(userID, connID, message)
+			conn.Dispatch(message)
+		}
+	}
+}
+
+// deliver dispatches an event about msg to the audience of msg
+func (w *wsGateway) deliver(msg domain.Message, members []int, messageFor func(userID int) model.Message) {
+	if msg.IsDirect() {
+		w.sendTo([]int{msg.UserID, msg.ToUserID}, messageFor)
+		return
+	}
+
+	w.broadcast(msg.RoomID, members, messageFor)
+}
+
+// sendTo dispatches the message built by messageFor to every connection of the users
+func (w *wsGateway) sendTo(userIDs []int, messageFor func(userID int) model.Message) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, userID := range userIDs {
+		userConnectionPool, ok := w.userConnectionPoolMap[userID]
+		if !ok {
+			continue
+		}
+
+		message := messageFor(userID)
+
+		for connID, conn := range userConnectionPool.Entries() {
+			w.logDispatch(userID, connID, message)
+			conn.Dispatch(message)
+		}
+	}
+}
+
+// broadcast dispatches the message built by messageFor to every connection listening
+// to the room whose user is a member of the room
+func (w *wsGateway) broadcast(roomID int, members []int, messageFor func(userID int) model.Message) {
+	isMember := w.roomAudience(roomID, members)
+
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
 	for userID, userConnectionPool := range w.userConnectionPoolMap {
-		userID := userID
-		message := model.Message{
-			ID:      messageID,
-			Type:    model.TextMessage,
-			Message: message,
-			User: model.User{
-				ID:   fromUserID,
-				IsMe: userID == fromUserID,
-			},
+		if !isMember(userID) {
+			continue
 		}
 
-		for connID, conn := range userConnectionPool.Slice() {
-			log.Printf("[DEBUG] Writing to [User ID: %d][Conn ID: %d] at %d", userID, connID, time.Now().UnixNano())
+		message := messageFor(userID)
+
+		for connID, conn := range userConnectionPool.Entries() {
+			if w.connectionSubscriptionMap[conn].RoomID != roomID {
+				continue
+			}
+
+			w.logDispatch(userID, connID, message)
 			conn.Dispatch(message)
 		}
 	}
 }
 
+// roomAudience tells whether a user receives the events of the room, from the
+// members carried by the event, or from the room membership known to this node
+// when there are none, as for the global room
+func (w *wsGateway) roomAudience(roomID int, members []int) func(userID int) bool {
+	if len(members) == 0 {
+		return func(userID int) bool {
+			return w.roomMembership.IsMember(roomID, userID)
+		}
+	}
+
+	memberSet := make(map[int]struct{}, len(members))
+	for _, userID := range members {
+		memberSet[userID] = struct{}{}
+	}
+
+	return func(userID int) bool {
+		_, ok := memberSet[userID]
+		return ok
+	}
+}
+
 // RegisterConnection implementation
-func (w *wsGateway) RegisterConnection(userID int, connection websocket.ConnectionDispatcher) (registrationID int) {
+func (w *wsGateway) RegisterConnection(userID int, subscription Subscription, connection websocket.ConnectionDispatcher) (registrationID int) {
+	if subscription.Ack {
+		connection = newAckingDispatcher(connection, w.ackTimeout, w.maxDeliveryRetries, func(msg model.Message) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			w.enqueueOffline(userID, msg)
+		})
+	}
+	if subscription.Resume {
+		connection = newResumingDispatcher(connection)
+	}
+	// the retries and the held back messages are counted once
+	connection = &meteredDispatcher{ConnectionDispatcher: connection, metrics: w.metrics}
+
 	w.mu.Lock()
 	if _, ok := w.userConnectionPoolMap[userID]; !ok {
 		w.userConnectionPoolMap[userID] = websocket.NewConnectionPool()
 	}
 	registrationID = w.userConnectionPoolMap[userID].Store(connection)
+	w.connectionSubscriptionMap[connection] = subscription
 	connection.StartDispatcher()
+	w.metrics.ConnectionOpened(userID)
+	w.markOnline(userID)
+	draining := w.draining
+	var undelivered []model.Message
+	if !draining {
+		undelivered = w.takeOffline(userID, subscription)
+	}
 	w.mu.Unlock()
 
+	w.log.With(logger.Fields{
+		logger.UserIDField:       userID,
+		logger.ConnectionIDField: registrationID,
+	}).Debugf("Connection registered to room %d, %d undelivered messages", subscription.RoomID, len(undelivered))
+
+	// the connection may be slow to read, do not hold the lock meanwhile
+	for i, msg := range undelivered {
+		if !connection.DispatchWait(msg) {
+			// the rest is kept for the next connection, with the message which
+			// was not queued
+			w.mu.Lock()
+			w.enqueueOffline(userID, undelivered[i:]...)
+			w.mu.Unlock()
+			break
+		}
+	}
+
+	// the connection was upgraded before the drain started, its undelivered
+	// messages are kept for the next one
+	if draining {
+		goAway(connection)
+	}
+
 	return
 }
 
@@ -74,11 +274,30 @@ func (w *wsGateway) UnregisterConnection(userID int, registrationID int) {
 		return
 	}
 
+	if acking, ok := ackingOf(connection); ok {
+		w.enqueueOffline(userID, acking.stop()...)
+	}
+
 	connection.StopDispatcher()
+	w.unregisteredTotals.add(connection.Stats())
 	userConnectionPool.Delete(registrationID)
+	delete(w.connectionSubscriptionMap, connection)
+	w.metrics.ConnectionClosed(userID)
+	w.log.With(logger.Fields{
+		logger.UserIDField:       userID,
+		logger.ConnectionIDField: registrationID,
+	}).Debugf("Connection unregistered")
+
+	if userConnectionPool.Size() == 0 {
+		w.markOffline(userID)
+	}
 }
 
+// TotalConnections implementation
 func (w *wsGateway) TotalConnections() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
 	n := 0
 	for _, connPool := range w.userConnectionPoolMap {
 		n += connPool.Size()
@@ -86,3 +305,48 @@ func (w *wsGateway) TotalConnections() int {
 
 	return n
 }
+
+// ConnectionsByUser implementation
+func (w *wsGateway) ConnectionsByUser() map[int]int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	connections := make(map[int]int, len(w.userConnectionPoolMap))
+	for userID, connPool := range w.userConnectionPoolMap {
+		if n := connPool.Size(); n > 0 {
+			connections[userID] = n
+		}
+	}
+
+	return connections
+}
+
+// OnlineUsers implementation
+func (w *wsGateway) OnlineUsers() []int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	userIDs := make([]int, 0, len(w.onlineUsers))
+	for userID := range w.onlineUsers {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+
+	return userIDs
+}
+
+// logDispatch traces the message dispatched to a connection
+func (w *wsGateway) logDispatch(userID int, connID int, message model.Message) {
+	if !w.log.Enabled(logger.DebugLevel) {
+		return
+	}
+
+	fields := logger.Fields{
+		logger.UserIDField:       userID,
+		logger.ConnectionIDField: connID,
+	}
+	if message.ID != 0 {
+		fields[logger.MessageIDField] = message.ID
+	}
+	w.log.With(fields).Debugf("Writing %s message", message.Type)
+}